@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/shantanuraj/listening/pkg/artwork"
+	"github.com/shantanuraj/listening/pkg/dirs"
+	"github.com/shantanuraj/listening/pkg/spotify"
+)
+
+const (
+	// maxArtSize is the width of the largest album art Spotify serves.
+	maxArtSize = 640
+	// Album art never changes for an album ID and size.
+	artCacheControl        = "public, max-age=31536000, immutable"
+	artPrivateCacheControl = "private, max-age=31536000, immutable"
+)
+
+func artCacheDir() (string, error) {
+	cacheDir, err := dirs.CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(cacheDir, "art"), nil
+}
+
+// artHandler serves album art from disk so pages need not hotlink Spotify's
+// CDN. size picks the image closest to that width, downscaling it when
+// Spotify only has larger ones, and the largest is served without it.
+func (app *App) artHandler(w http.ResponseWriter, r *http.Request) {
+	log := app.log.WithContext(r.Context())
+
+	albumID := r.PathValue("albumID")
+	if !validSpotifyID(albumID) {
+		http.Error(w, "invalid album id", http.StatusBadRequest)
+		return
+	}
+	size := 0
+	if v := r.URL.Query().Get("size"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxArtSize {
+			http.Error(w, fmt.Sprintf("size must be between 1 and %d", maxArtSize), http.StatusBadRequest)
+			return
+		}
+		size = parsed
+	}
+
+	key := fmt.Sprintf("%s-%d", albumID, size)
+	data, ok := app.art.Get(key)
+	if !ok {
+		var err error
+		data, err = app.fetchArt(r.Context(), albumID, size)
+		switch {
+		case errors.Is(err, spotify.ErrNotAuthenticated):
+			http.Error(w, "not authenticated", http.StatusUnauthorized)
+			return
+		case errors.Is(err, spotify.ErrNotFound):
+			http.Error(w, "album not found", http.StatusNotFound)
+			return
+		case err != nil:
+			log.Errorf("art: failed to fetch album art for %s: %v", albumID, err)
+			http.Error(w, "failed to fetch album art", http.StatusBadGateway)
+			return
+		}
+		if err := app.art.Put(key, data); err != nil {
+			log.Errorf("art: failed to cache album art for %s: %v", albumID, err)
+		}
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", http.DetectContentType(data))
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	h.Add("Vary", "Authorization")
+	if isPrivate(r) {
+		h.Set("Cache-Control", artPrivateCacheControl)
+	} else {
+		h.Set("Cache-Control", artCacheControl)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// fetchArt downloads the album image closest to size, or the largest one
+// when size is 0.
+func (app *App) fetchArt(ctx context.Context, albumID string, size int) ([]byte, error) {
+	if err := app.client.EnsureAuthenticated(ctx); err != nil {
+		return nil, err
+	}
+	album, err := app.client.Album(ctx, albumID)
+	if err != nil {
+		return nil, err
+	}
+
+	want := int64(size)
+	if size == 0 {
+		want = math.MaxInt64
+	}
+	closest, ok := spotify.ClosestImage(album.Images, want)
+	if !ok {
+		return nil, spotify.ErrNotFound
+	}
+
+	image, err := app.images.Fetch(ctx, closest.URL)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 || closest.Width <= want || image.ContentType != "image/jpeg" {
+		return image.Data, nil
+	}
+
+	resized, err := artwork.Downscale(image.Data, size)
+	if err != nil {
+		app.log.WithContext(ctx).Errorf("art: failed to downscale album art for %s: %v", albumID, err)
+		return image.Data, nil
+	}
+	return resized, nil
+}
+
+// validSpotifyID reports whether id looks like a Spotify ID, 22 base62
+// characters, so nothing else ends up in a cache file name or upstream path.
+func validSpotifyID(id string) bool {
+	if len(id) != 22 {
+		return false
+	}
+	for _, c := range id {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/badge"
+	"github.com/shantanuraj/listening/pkg/spotify"
+)
+
+const (
+	// Album art is inlined at twice the size it is shown at in the badge.
+	badgeArtSize    = 160
+	badgeArtTimeout = 3 * time.Second
+
+	badgeImageCacheSize = 8 << 20
+	badgeImageMaxSize   = 1 << 20
+)
+
+// badgeHandler renders the currently playing track as an SVG for READMEs
+// and other pages that cannot run JavaScript. Image proxies like GitHub's
+// camo cache images unless told not to, so the badge is revalidated on every
+// view. Progress is shown as of the last fetch from Spotify rather than moved
+// forward per request, so the badge is answered with 304 until the next one.
+func (app *App) badgeHandler(w http.ResponseWriter, r *http.Request) {
+	log := app.log.WithContext(r.Context())
+	query := r.URL.Query()
+
+	theme, err := badge.ParseTheme(query.Get("theme"))
+	if err != nil {
+		http.Error(w, "invalid theme", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := getCached(r, app.current, none{})
+	if err != nil {
+		log.Errorf("badge: failed to fetch currently listening: %v", err)
+		http.Error(w, "failed to fetch currently listening", http.StatusInternalServerError)
+		return
+	}
+
+	var b badge.Badge
+	if current := entry.Value; current != nil && current.Item.Name != "" {
+		b = badge.Badge{
+			Playing:  current.IsPlaying,
+			Title:    current.Item.Name,
+			Progress: time.Duration(current.ProgressMS) * time.Millisecond,
+			Duration: time.Duration(current.Item.DurationMS) * time.Millisecond,
+		}
+		for _, artist := range current.Item.Artists {
+			b.Artists = append(b.Artists, artist.Name)
+		}
+		if query.Get("art") != "false" {
+			b.Art = app.badgeArt(r.Context(), current.Item.Album)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := badge.Render(&buf, theme, b); err != nil {
+		log.Errorf("badge: failed to render: %v", err)
+		http.Error(w, "failed to render badge", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:16]))
+
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Add("Vary", "Authorization")
+	if isPrivate(r) {
+		h.Set("Cache-Control", "private, no-cache, max-age=0, must-revalidate")
+	} else {
+		h.Set("Cache-Control", "no-cache, max-age=0, must-revalidate")
+	}
+	h.Set("Expires", time.Unix(0, 0).UTC().Format(http.TimeFormat))
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// badgeArt returns the album art as a data URI, or "" when it cannot be
+// fetched in time so the badge renders without it.
+func (app *App) badgeArt(ctx context.Context, album spotify.Album) string {
+	image, ok := spotify.ClosestImage(album.Images, badgeArtSize)
+	if !ok {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, badgeArtTimeout)
+	defer cancel()
+
+	art, err := app.images.Get(ctx, image.URL)
+	if err != nil {
+		app.log.WithContext(ctx).Errorf("badge: failed to fetch album art: %v", err)
+		return ""
+	}
+
+	switch art.ContentType {
+	case "image/jpeg", "image/png", "image/webp", "image/gif":
+	default:
+		return ""
+	}
+	return "data:" + art.ContentType + ";base64," + base64.StdEncoding.EncodeToString(art.Data)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/artwork"
+	"github.com/shantanuraj/listening/pkg/cache"
+	"github.com/shantanuraj/listening/pkg/config"
+	"github.com/shantanuraj/listening/pkg/dirs"
+	"github.com/shantanuraj/listening/pkg/imagecache"
+	"github.com/shantanuraj/listening/pkg/log"
+	"github.com/shantanuraj/listening/pkg/spotify"
+)
+
+func newApp(client *spotify.Client, log *log.Logger, cfg config.Caches) *App {
+	app := &App{
+		client:   client,
+		log:      log,
+		images:   imagecache.New(badgeImageCacheSize, badgeImageMaxSize),
+		palettes: artwork.NewPalettes(paletteCacheSize),
+
+		recent: cache.New(
+			func(ctx context.Context, _ none) (*spotify.RecentlyPlayedResponse, error) {
+				return client.RecentlyPlayed(ctx, maxLimit)
+			},
+			cacheOptions("recent", cfg.Recent),
+		),
+		topArtists: cache.New(
+			func(ctx context.Context, timeRange spotify.TimeRange) (*spotify.TopArtistsResponse, error) {
+				return client.TopArtists(ctx, timeRange, maxLimit)
+			},
+			cacheOptions("top-artists", cfg.Top),
+		),
+		topTracks: cache.New(
+			func(ctx context.Context, timeRange spotify.TimeRange) (*spotify.TopTracksResponse, error) {
+				return client.TopTracks(ctx, timeRange, maxLimit)
+			},
+			cacheOptions("top-tracks", cfg.Top),
+		),
+	}
+	app.current = cache.New(app.fetchCurrent, cacheOptions("current", cfg.Current))
+	app.queue = cache.New(app.fetchQueue, cacheOptions("queue", cfg.Queue))
+	return app
+}
+
+func cacheOptions(name string, cfg config.Cache) cache.Options {
+	return cache.Options{
+		Name:        name,
+		FreshTTL:    time.Duration(cfg.Fresh),
+		StaleTTL:    time.Duration(cfg.Stale),
+		MinInterval: time.Duration(cfg.MinInterval),
+	}
+}
+
+// setCacheOptions applies new TTLs to every cache, keeping their values.
+func (app *App) setCacheOptions(cfg config.Caches) {
+	app.current.SetOptions(cacheOptions("current", cfg.Current))
+	app.queue.SetOptions(cacheOptions("queue", cfg.Queue))
+	app.recent.SetOptions(cacheOptions("recent", cfg.Recent))
+	app.topArtists.SetOptions(cacheOptions("top-artists", cfg.Top))
+	app.topTracks.SetOptions(cacheOptions("top-tracks", cfg.Top))
+}
+
+type persistentCache interface {
+	Options() cache.Options
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+	Purge()
+	Close()
+}
+
+func (app *App) caches() []persistentCache {
+	return []persistentCache{app.current, app.queue, app.recent, app.topArtists, app.topTracks}
+}
+
+func cachePath(c persistentCache) (string, error) {
+	cacheDir, err := dirs.CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(cacheDir, c.Options().Name+".cache.json"), nil
+}
+
+// restoreCaches loads the cache snapshots written by saveCaches so a restart
+// does not start cold.
+func (app *App) restoreCaches() {
+	for _, c := range app.caches() {
+		path, err := cachePath(c)
+		if err != nil {
+			app.log.Errorf("failed to get cache path: %v", err)
+			return
+		}
+
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			app.log.Errorf("failed to open cache %s: %v", path, err)
+			continue
+		}
+		if err := c.Load(file); err != nil {
+			app.log.Errorf("failed to restore cache %s: %v", path, err)
+		}
+		file.Close()
+	}
+}
+
+// purgeCaches drops every cached response, in memory and on disk, since
+// they all contain the listening history of the logged in account.
+func (app *App) purgeCaches() {
+	for _, c := range app.caches() {
+		c.Purge()
+
+		path, err := cachePath(c)
+		if err != nil {
+			app.log.Errorf("failed to get cache path: %v", err)
+			return
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			app.log.Errorf("failed to delete cache %s: %v", path, err)
+		}
+	}
+
+	// Cached album art and palettes give away what was played as well. The
+	// CLI has no art cache open, so it removes the directory instead.
+	app.images.Purge()
+	app.palettes.Purge()
+	if app.art != nil {
+		if err := app.art.Purge(); err != nil {
+			app.log.Errorf("failed to delete art cache: %v", err)
+		}
+		return
+	}
+	artDir, err := artCacheDir()
+	if err != nil {
+		app.log.Errorf("failed to get art cache path: %v", err)
+		return
+	}
+	if err := os.RemoveAll(artDir); err != nil {
+		app.log.Errorf("failed to delete art cache %s: %v", artDir, err)
+	}
+}
+
+// closeCaches cancels and waits for any background revalidations.
+func (app *App) closeCaches() {
+	for _, c := range app.caches() {
+		c.Close()
+	}
+}
+
+// saveCaches writes a snapshot of every cache to disk.
+func (app *App) saveCaches() {
+	for _, c := range app.caches() {
+		path, err := cachePath(c)
+		if err != nil {
+			app.log.Errorf("failed to get cache path: %v", err)
+			return
+		}
+
+		file, err := os.Create(path)
+		if err != nil {
+			app.log.Errorf("failed to create cache %s: %v", path, err)
+			continue
+		}
+		if err := c.Save(file); err != nil {
+			app.log.Errorf("failed to save cache %s: %v", path, err)
+		}
+		file.Close()
+	}
+}
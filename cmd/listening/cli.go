@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/config"
+	"github.com/shantanuraj/listening/pkg/funk"
+	"github.com/shantanuraj/listening/pkg/log"
+	"github.com/shantanuraj/listening/pkg/spotify"
+)
+
+// How long login waits for the OAuth callback before giving up.
+const loginTimeout = 5 * time.Minute
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "serve [flags]", "run the HTTP server (default)", runServe},
+		{"login", "login [--device]", "authorize with Spotify and store the token", runLogin},
+		{"logout", "logout", "delete the stored token and cached responses", runLogout},
+		{"now", "now [--json]", "show the currently playing track", runNow},
+		{"queue", "queue [--json] [--limit n]", "show the upcoming tracks", runQueue},
+		{"recent", "recent [--json] [--limit n]", "show recently played tracks", runRecent},
+		{"play", "play [--json] <uri>", "play a track, album, artist or playlist URI", runPlay},
+		{"help", "help", "show this help", runHelp},
+	}
+}
+
+func main() {
+	args := os.Args[1:]
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(args)
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "listening %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "listening: unknown command %q\n\n", name)
+	printUsage(os.Stderr)
+	os.Exit(2)
+}
+
+func runHelp(args []string) error {
+	printUsage(os.Stdout)
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: listening <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-30s %s\n", cmd.usage, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Every command also accepts the configuration flags, see 'listening serve -h'.")
+}
+
+// cli holds what the headless commands share: the parsed configuration,
+// a client using the stored credentials, and the output format.
+type cli struct {
+	cfg    *config.Config
+	client *spotify.Client
+	json   bool
+	args   []string
+}
+
+// newCLI parses args for the command called name, after define has added
+// any command specific flags. Logs go to stderr so that stdout only carries
+// the command's output.
+func newCLI(name string, args []string, define func(fs *flag.FlagSet)) (*cli, error) {
+	log.SetDefault(log.NewWriter(os.Stderr))
+
+	fs := flag.NewFlagSet("listening "+name, flag.ContinueOnError)
+	flags := config.AddFlags(fs)
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	if define != nil {
+		define(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg, err := config.Load(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cli{
+		cfg:    cfg,
+		client: spotify.NewClient(cfg.Spotify),
+		json:   *asJSON,
+		args:   fs.Args(),
+	}, nil
+}
+
+// limitFlag defines the --limit flag shared by the list commands.
+func limitFlag(limit *int) func(fs *flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		fs.IntVar(limit, "limit", defaultLimit, fmt.Sprintf("number of tracks to show, at most %d", maxLimit))
+	}
+}
+
+func validateLimit(limit int) error {
+	if limit < 1 || limit > maxLimit {
+		return fmt.Errorf("limit must be between 1 and %d", maxLimit)
+	}
+	return nil
+}
+
+// authenticate loads the stored token, refreshing it if needed, and checks
+// it was granted the scopes feature needs.
+func (c *cli) authenticate(ctx context.Context, feature spotify.Feature) error {
+	if err := c.client.LoadToken(); err != nil {
+		return err
+	}
+	if err := c.client.EnsureAuthenticated(ctx); err != nil {
+		if errors.Is(err, spotify.ErrNotAuthenticated) {
+			return fmt.Errorf("%w, run 'listening login' first", err)
+		}
+		return err
+	}
+	if missing := c.client.FeatureMissingScopes(feature); len(missing) > 0 {
+		return fmt.Errorf("the stored token is missing %s, run 'listening login' to grant it", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (c *cli) printJSON(data any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+func runLogin(args []string) error {
+	var device bool
+	c, err := newCLI("login", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&device, "device", false, "log in from another machine with a one-time code")
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keep the scopes the stored token already has when asking for new ones
+	if err := c.client.LoadToken(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), loginTimeout)
+	defer cancel()
+
+	if device {
+		return c.deviceLogin(ctx)
+	}
+
+	listener, err := net.Listen("tcp", c.cfg.ListenAddr())
+	if err != nil {
+		return fmt.Errorf("failed to listen for the callback at %s: %w", c.cfg.ListenAddr(), err)
+	}
+
+	loginURL, state := c.client.LoginURL(c.cfg.Addr)
+	done := make(chan error, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("state") != state {
+			http.Error(w, "state mismatch", http.StatusBadRequest)
+			return
+		}
+		code := query.Get("code")
+		if code == "" {
+			http.Error(w, "missing code", http.StatusBadRequest)
+			done <- fmt.Errorf("authorization denied: %s", query.Get("error"))
+			return
+		}
+		if err := c.client.CompleteLogin(r.Context(), c.cfg.Addr, code); err != nil {
+			http.Error(w, "failed to exchange code for token", http.StatusInternalServerError)
+			done <- err
+			return
+		}
+		fmt.Fprintln(w, "Logged in, you can close this window.")
+		done <- nil
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	fmt.Fprintln(os.Stderr, "Open this URL in a browser to log in:")
+	fmt.Println(loginURL)
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out waiting for the callback")
+	}
+	if err != nil {
+		return err
+	}
+
+	// Let the browser receive the response before the listener goes away
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShutdown()
+	server.Shutdown(shutdownCtx)
+
+	fmt.Fprintln(os.Stderr, "Logged in.")
+	return nil
+}
+
+// deviceLogin serves only the device login relay page until the operator
+// completes the flow from a browser.
+func (c *cli) deviceLogin(ctx context.Context) error {
+	listener, err := net.Listen("tcp", c.cfg.ListenAddr())
+	if err != nil {
+		return fmt.Errorf("failed to listen at %s: %w", c.cfg.ListenAddr(), err)
+	}
+
+	d := c.client.NewDeviceLogin(c.cfg.Addr)
+	mux := http.NewServeMux()
+	d.Register(mux, nil)
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	code := d.Start()
+	fmt.Fprintf(os.Stderr, "Visit %s and enter the code:\n", d.URL())
+	fmt.Println(code)
+
+	if err := d.Wait(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("timed out waiting for the login")
+		}
+		return err
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShutdown()
+	server.Shutdown(shutdownCtx)
+
+	fmt.Fprintln(os.Stderr, "Logged in.")
+	return nil
+}
+
+func runLogout(args []string) error {
+	c, err := newCLI("logout", args, nil)
+	if err != nil {
+		return err
+	}
+
+	// A running server would write its token and caches back on the next
+	// refresh or at shutdown, so it has to be signed out itself.
+	listener, err := net.Listen("tcp", c.cfg.ListenAddr())
+	if err != nil {
+		return fmt.Errorf("a server seems to be running at %s, sign it out with POST /logout instead", c.cfg.ListenAddr())
+	}
+	listener.Close()
+
+	if err := c.client.Logout(); err != nil {
+		return err
+	}
+
+	app := newApp(c.client, log.NewWriter(os.Stderr), c.cfg.Cache)
+	app.purgeCaches()
+
+	fmt.Fprintln(os.Stderr, "Logged out. A server started from the same config directory on another address must be signed out with POST /logout, or it will write its token back.")
+	return nil
+}
+
+func runNow(args []string) error {
+	c, err := newCLI("now", args, nil)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := c.authenticate(ctx, spotify.FeatureCurrent); err != nil {
+		return err
+	}
+
+	listening, err := c.client.CurrentlyListening(ctx)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(listening)
+	}
+	if listening == nil {
+		fmt.Println("Nothing playing")
+		return nil
+	}
+
+	state := "Playing"
+	if !listening.IsPlaying {
+		state = "Paused"
+	}
+	fmt.Printf(
+		"%s: %s (%s / %s)\n",
+		state,
+		formatTrack(listening.Item.Name, listening.Item.Artists),
+		formatDuration(listening.ProgressMS),
+		formatDuration(listening.Item.DurationMS),
+	)
+	return nil
+}
+
+func runQueue(args []string) error {
+	var limit int
+	c, err := newCLI("queue", args, limitFlag(&limit))
+	if err != nil {
+		return err
+	}
+	if err := validateLimit(limit); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := c.authenticate(ctx, spotify.FeatureQueue); err != nil {
+		return err
+	}
+
+	queue, err := c.client.Queue(ctx)
+	if err != nil {
+		return err
+	}
+	if queue != nil {
+		queue.Queue = funk.Range(queue.Queue, 0, limit)
+	}
+
+	if c.json {
+		return c.printJSON(queue)
+	}
+	if queue == nil || len(queue.Queue) == 0 {
+		fmt.Println("Queue is empty")
+		return nil
+	}
+	for i, item := range queue.Queue {
+		fmt.Printf("%d. %s\n", i+1, formatTrack(item.Name, item.Artists))
+	}
+	return nil
+}
+
+func runRecent(args []string) error {
+	var limit int
+	c, err := newCLI("recent", args, limitFlag(&limit))
+	if err != nil {
+		return err
+	}
+	if err := validateLimit(limit); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := c.authenticate(ctx, spotify.FeatureRecent); err != nil {
+		return err
+	}
+
+	recent, err := c.client.RecentlyPlayed(ctx, limit)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(recent)
+	}
+	for _, item := range recent.Items {
+		fmt.Printf(
+			"%s  %s\n",
+			item.PlayedAt.Local().Format(time.DateTime),
+			formatTrack(item.Track.Name, item.Track.Artists),
+		)
+	}
+	return nil
+}
+
+func runPlay(args []string) error {
+	c, err := newCLI("play", args, nil)
+	if err != nil {
+		return err
+	}
+	if len(c.args) != 1 {
+		return fmt.Errorf("expected exactly one URI, got %d", len(c.args))
+	}
+
+	req, err := playRequest(c.args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := c.authenticate(ctx, spotify.FeaturePlay); err != nil {
+		return err
+	}
+
+	if err := c.client.Play(ctx, req); err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(req)
+	}
+	fmt.Printf("Playing %s\n", c.args[0])
+	return nil
+}
+
+// playRequest builds a play request for a spotify: URI or open.spotify.com
+// link. Tracks are played directly, everything else as a context.
+func playRequest(uri string) (spotify.PlayRequest, error) {
+	if u, err := url.Parse(uri); err == nil && u.Host == "open.spotify.com" {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) != 2 {
+			return spotify.PlayRequest{}, fmt.Errorf("unsupported link %q", uri)
+		}
+		uri = fmt.Sprintf("spotify:%s:%s", parts[0], parts[1])
+	}
+
+	parts := strings.Split(uri, ":")
+	if len(parts) != 3 || parts[0] != "spotify" || parts[2] == "" {
+		return spotify.PlayRequest{}, fmt.Errorf("invalid spotify URI %q", uri)
+	}
+
+	switch parts[1] {
+	case "track", "episode":
+		return spotify.PlayRequest{URIs: []string{uri}}, nil
+	case "album", "artist", "playlist", "show":
+		return spotify.PlayRequest{ContextURI: uri}, nil
+	default:
+		return spotify.PlayRequest{}, fmt.Errorf("unsupported spotify URI type %q", parts[1])
+	}
+}
+
+func formatTrack(name string, artists []spotify.Artist) string {
+	names := make([]string, len(artists))
+	for i, artist := range artists {
+		names[i] = artist.Name
+	}
+	return fmt.Sprintf("%s - %s", name, strings.Join(names, ", "))
+}
+
+func formatDuration(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// How long the server stays ready after Spotify calls start failing.
+const upstreamWindow = 5 * time.Minute
+
+type check struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type probe struct {
+	Status string           `json:"status"`
+	Checks map[string]check `json:"checks,omitempty"`
+}
+
+func newCheck(err error) check {
+	if err != nil {
+		return check{Status: "fail", Error: err.Error()}
+	}
+	return check{Status: "ok"}
+}
+
+// healthzHandler reports that the process is up and serving requests.
+func (app *App) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, probe{Status: "ok"}, http.StatusOK)
+}
+
+// readyzHandler reports whether the server can answer read routes: it holds
+// a usable token, Spotify has answered recently and the config on disk loads.
+func (app *App) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	var configErr error
+	if err := app.reloadErr.Load(); err != nil {
+		configErr = *err
+	}
+
+	result := probe{
+		Status: "ok",
+		Checks: map[string]check{
+			"config":   newCheck(configErr),
+			"token":    newCheck(app.client.CheckToken()),
+			"upstream": newCheck(app.client.CheckUpstream(upstreamWindow)),
+		},
+	}
+
+	status := http.StatusOK
+	for _, c := range result.Checks {
+		if c.Status != "ok" {
+			result.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeProbe(w, result, status)
+}
+
+func writeProbe(w http.ResponseWriter, result probe, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -1,209 +1,131 @@
 package main
 
 import (
-	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync/atomic"
 
+	"github.com/shantanuraj/listening/pkg/apikey"
+	"github.com/shantanuraj/listening/pkg/artwork"
+	"github.com/shantanuraj/listening/pkg/cache"
+	"github.com/shantanuraj/listening/pkg/config"
+	"github.com/shantanuraj/listening/pkg/diskcache"
 	"github.com/shantanuraj/listening/pkg/funk"
+	"github.com/shantanuraj/listening/pkg/imagecache"
 	"github.com/shantanuraj/listening/pkg/log"
 	"github.com/shantanuraj/listening/pkg/middleware"
 	"github.com/shantanuraj/listening/pkg/spotify"
 )
 
-var (
-	host           = cmp.Or(os.Getenv("SL_HOST"), "localhost")
-	port           = cmp.Or(os.Getenv("SL_PORT"), "5050")
-	addr           = cmp.Or(os.Getenv("SL_ADDR"), fmt.Sprintf("http://%s:%s", host, port))
-	enabledOrigins = []string{
-		cmp.Or(os.Getenv("SL_DEV_ORIGIN"), "http://localhost:4321"),
-		cmp.Or(os.Getenv("SL_PROD_ORIGIN"), "https://sraj.me"),
-	}
-)
-
 type App struct {
 	client *spotify.Client
 	log    *log.Logger
-}
-
-func main() {
-	client := spotify.DefaultClient
-	log := log.New()
-	app := &App{
-		client: client,
-		log:    log,
-	}
 
-	mux := http.NewServeMux()
-
-	client.RegisterAuthenticationHandlers(addr, mux)
-	mux.HandleFunc("GET /current", client.AuthMiddleware(app.currentTrackHandler))
-	mux.HandleFunc("GET /queue", client.AuthMiddleware(app.queueHandler))
-	mux.HandleFunc("GET /recent", client.AuthMiddleware(app.recentHandler))
-	mux.HandleFunc("PUT /play", client.AuthMiddleware(app.playHandler))
-
-	enableCors := middleware.WithCors(enabledOrigins)
-	enableLogging := middleware.WithLogging(log)
-
-	log.Infof("listening on %s", addr)
-
-	if err := http.ListenAndServe(fmt.Sprintf("%s:%s", host, port), enableCors(enableLogging(mux))); err != nil {
-		log.Fatalf("failed to listen at %s %v", addr, err)
-	}
+	flags          *config.Flags
+	cfg            *config.Config
+	keys           *apikey.Store
+	cors           *middleware.Cors
+	readLimiter    *middleware.RateLimiter
+	controlLimiter *middleware.RateLimiter
+	accessLog      *middleware.AccessLog
+	// reloadErr is why the last config reload failed, nil if it succeeded.
+	reloadErr atomic.Pointer[error]
+
+	current    *cache.SWR[none, *currentResponse]
+	queue      *cache.SWR[none, *queueResponse]
+	recent     *cache.SWR[none, *spotify.RecentlyPlayedResponse]
+	topArtists *cache.SWR[spotify.TimeRange, *spotify.TopArtistsResponse]
+	topTracks  *cache.SWR[spotify.TimeRange, *spotify.TopTracksResponse]
+	images     *imagecache.Cache
+	palettes   *artwork.Palettes
+	art        *diskcache.Cache
 }
 
-var storedTrack atomic.Value
+type none = struct{}
 
 func (app *App) currentTrackHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	log := app.log
-	client := app.client
-
-	query := r.URL.Query()
-	skipCache := query.Has("skip-cache")
-
-	writeResponse := true
-
-	if stored := storedTrack.Load(); !skipCache && stored != nil {
-		log.Infof("serving stored track")
-		track := stored.(*spotify.CurrentlyPlayingResponse)
-		writeJSON(w, track)
-		writeResponse = false
-	}
-
-	log.Infof("fetching currently listening")
+	log := app.log.WithContext(r.Context())
 
-	listening, err := client.CurrentlyListening(ctx)
+	entry, err := getCached(r, app.current, none{})
 	if err != nil {
 		log.Errorf("failed to fetch currently listening: %v", err)
-	} else {
-		storedTrack.Store(listening)
-	}
-	if !writeResponse {
-		return
-	}
-
-	if err != nil {
 		http.Error(w, "failed to fetch currently listening", http.StatusInternalServerError)
 		return
 	}
+	log.Infof("serving %s track", entry.State)
 
+	listening := entry.Value
 	if listening == nil {
-		w.WriteHeader(http.StatusNoContent)
+		writeCachedNoContent(w, r, entry)
 		return
 	}
 
-	writeJSON(w, listening)
+	writeCachedJSON(w, r, entry, listening)
 }
 
-var storedQueue atomic.Value
-
 const defaultLimit = 5
 const maxLimit = 15
 
 func (app *App) queueHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	log := app.log
-	client := app.client
-
-	query := r.URL.Query()
-	skipCache := query.Has("skip-cache")
-
-	limit := defaultLimit
-	limitStr := query.Get("limit")
-	if limitStr != "" {
-		limitValue, err := strconv.Atoi(limitStr)
-		if err != nil {
-			http.Error(w, "invalid limit", http.StatusBadRequest)
-			return
-		}
-		if limitValue < 1 || limitValue > maxLimit {
-			http.Error(w, "invalid limit", http.StatusBadRequest)
-			return
-		}
-		limit = limitValue
-	}
+	log := app.log.WithContext(r.Context())
 
-	writeResponse := true
-
-	if stored := storedQueue.Load(); !skipCache && stored != nil {
-		log.Infof("serving stored queue")
-		queue := stored.(*spotify.QueueResponse)
-		if queue != nil {
-			queue.Queue = funk.Range(queue.Queue, 0, limit)
-		}
-		writeJSON(w, queue)
-		writeResponse = false
-	}
-
-	log.Infof("fetching queue")
-
-	queue, err := client.Queue(ctx)
+	limit, err := parseLimit(r.URL.Query())
 	if err != nil {
-		log.Errorf("failed to fetch queue: %v", err)
-	} else {
-		storedQueue.Store(queue)
-	}
-	if !writeResponse {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
 		return
 	}
 
+	entry, err := getCached(r, app.queue, none{})
 	if err != nil {
+		log.Errorf("failed to fetch queue: %v", err)
 		http.Error(w, "failed to fetch queue", http.StatusInternalServerError)
 		return
 	}
+	log.Infof("serving %s queue", entry.State)
 
-	if queue == nil {
-		w.WriteHeader(http.StatusNoContent)
+	if entry.Value == nil {
+		writeCachedNoContent(w, r, entry)
 		return
 	}
 
+	queue := *entry.Value
 	queue.Queue = funk.Range(queue.Queue, 0, limit)
 
-	writeJSON(w, queue)
+	writeCachedJSON(w, r, entry, queue)
 }
 
 func (app *App) recentHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	log := app.log
-	client := app.client
-
-	query := r.URL.Query()
+	log := app.log.WithContext(r.Context())
 
-	limit := defaultLimit
-	limitStr := query.Get("limit")
-	if limitStr != "" {
-		limitValue, err := strconv.Atoi(limitStr)
-		if err != nil {
-			http.Error(w, "invalid limit", http.StatusBadRequest)
-			return
-		}
-		if limitValue < 1 || limitValue > maxLimit {
-			http.Error(w, "invalid limit", http.StatusBadRequest)
-			return
-		}
-		limit = limitValue
+	limit, err := parseLimit(r.URL.Query())
+	if err != nil {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
 	}
 
-	log.Infof("fetching recent tracks")
-
-	recent, err := client.RecentlyPlayed(ctx, limit)
+	entry, err := getCached(r, app.recent, none{})
 	if err != nil {
 		log.Errorf("failed to fetch recently played: %v", err)
 		http.Error(w, "failed to fetch recently played", http.StatusInternalServerError)
 		return
 	}
+	log.Infof("serving %s recent tracks", entry.State)
 
-	writeJSON(w, recent)
+	recent := *entry.Value
+	recent.Items = funk.Range(recent.Items, 0, limit)
+
+	writeCachedJSON(w, r, entry, recent)
 }
 
 func (app *App) playHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	log := app.log
+	log := app.log.WithContext(r.Context())
 	client := app.client
 
 	var req spotify.PlayRequest
@@ -222,6 +144,102 @@ func (app *App) playHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (app *App) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	log := app.log.WithContext(r.Context())
+
+	if err := app.client.Logout(); err != nil {
+		log.Errorf("logout: %v", err)
+		http.Error(w, "logout: failed to delete credentials", http.StatusInternalServerError)
+		return
+	}
+	app.purgeCaches()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) authStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status := app.client.Status(r.Context())
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status)
+}
+
+// getCached reads key from c, bypassing cached values when the request
+// carries the skip-cache query parameter.
+func getCached[K comparable, V any](r *http.Request, c *cache.SWR[K, V], key K) (cache.Entry[V], error) {
+	if r.URL.Query().Has("skip-cache") {
+		return c.Refresh(r.Context(), key)
+	}
+	return c.Get(r.Context(), key)
+}
+
+func parseLimit(query url.Values) (int, error) {
+	limitStr := query.Get("limit")
+	if limitStr == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		return 0, err
+	}
+	if limit < 1 || limit > maxLimit {
+		return 0, fmt.Errorf("limit out of range: %d", limit)
+	}
+	return limit, nil
+}
+
+// writeCachedJSON writes data with caching headers derived from entry,
+// answering a matching If-None-Match with 304 Not Modified.
+func writeCachedJSON[V any](w http.ResponseWriter, r *http.Request, entry cache.Entry[V], data any) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+
+	sum := sha256.Sum256(body)
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:16]))
+
+	h := w.Header()
+	h.Set("ETag", etag)
+	entry.SetHeaders(h, isPrivate(r))
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// writeCachedNoContent writes a 204 with caching headers derived from entry.
+func writeCachedNoContent[V any](w http.ResponseWriter, r *http.Request, entry cache.Entry[V]) {
+	entry.SetHeaders(w.Header(), isPrivate(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isPrivate reports whether r was authorized with an API key, in which case
+// the response must not be stored by shared caches and served to others.
+func isPrivate(r *http.Request) bool {
+	_, ok := apikey.FromContext(r.Context())
+	return ok
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using
+// the weak comparison RFC 9110 requires for GET requests.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func writeJSON(w http.ResponseWriter, data any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
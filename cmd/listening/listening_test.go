@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `"abc"`
+
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{"", false},
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{`"xyz",W/"abc"`, true},
+		{"*", true},
+		{`"xyz"`, false},
+		{`abc`, false},
+		{`"abcd"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.ifNoneMatch, etag, got, tt.want)
+		}
+	}
+}
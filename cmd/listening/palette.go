@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/artwork"
+	"github.com/shantanuraj/listening/pkg/spotify"
+)
+
+const (
+	// Palettes are picked from the smallest album art, which has plenty of
+	// pixels to sample and is the quickest to fetch.
+	paletteArtSize   = 64
+	paletteTimeout   = 2 * time.Second
+	paletteCacheSize = 1024
+)
+
+// currentResponse is the currently playing track with the palette of its
+// album art.
+type currentResponse struct {
+	*spotify.CurrentlyPlayingResponse
+	Palette *artwork.Palette `json:"palette,omitempty"`
+}
+
+type queueResponse struct {
+	Queue []queueItem `json:"queue"`
+}
+
+type queueItem struct {
+	spotify.QueueItem
+	Palette *artwork.Palette `json:"palette,omitempty"`
+}
+
+// fetchCurrent is the fetcher of the current cache. Palettes are looked up
+// here rather than in the handlers so that, like the track itself, they are
+// fetched once per revalidation no matter how many requests are waiting.
+func (app *App) fetchCurrent(ctx context.Context, _ none) (*currentResponse, error) {
+	current, err := app.client.CurrentlyListening(ctx)
+	if err != nil || current == nil {
+		return nil, err
+	}
+	return &currentResponse{
+		CurrentlyPlayingResponse: current,
+		Palette:                  app.albumPalette(ctx, current.Item.Album),
+	}, nil
+}
+
+// fetchQueue is the fetcher of the queue cache, looking up palettes like
+// fetchCurrent.
+func (app *App) fetchQueue(ctx context.Context, _ none) (*queueResponse, error) {
+	queue, err := app.client.Queue(ctx)
+	if err != nil || queue == nil {
+		return nil, err
+	}
+
+	albums := make([]spotify.Album, len(queue.Queue))
+	for i, item := range queue.Queue {
+		albums[i] = item.Album
+	}
+	palettes := app.albumPalettes(ctx, albums)
+
+	resp := &queueResponse{Queue: make([]queueItem, len(queue.Queue))}
+	for i, item := range queue.Queue {
+		resp.Queue[i] = queueItem{QueueItem: item, Palette: palettes[i]}
+	}
+	return resp, nil
+}
+
+// albumPalette returns the palette of the album art, or nil when the album
+// has no art or it cannot be fetched in time, so responses go out without
+// it instead of failing.
+func (app *App) albumPalette(ctx context.Context, album spotify.Album) *artwork.Palette {
+	if album.ID == "" {
+		return nil
+	}
+	if palette, ok := app.palettes.Get(album.ID); ok {
+		return &palette
+	}
+	image, ok := spotify.ClosestImage(album.Images, paletteArtSize)
+	if !ok {
+		return nil
+	}
+
+	log := app.log.WithContext(ctx)
+	ctx, cancel := context.WithTimeout(ctx, paletteTimeout)
+	defer cancel()
+
+	art, err := app.images.Fetch(ctx, image.URL)
+	if err != nil {
+		log.Errorf("palette: failed to fetch album art for %s: %v", album.ID, err)
+		return nil
+	}
+	palette, err := artwork.DecodePalette(art.Data)
+	if err != nil {
+		log.Errorf("palette: failed to decode album art for %s: %v", album.ID, err)
+		return nil
+	}
+
+	app.palettes.Add(album.ID, palette)
+	return &palette
+}
+
+// albumPalettes looks up the palettes of several albums at once, fetching
+// each distinct album only once.
+func (app *App) albumPalettes(ctx context.Context, albums []spotify.Album) []*artwork.Palette {
+	byID := make(map[string]*artwork.Palette)
+	seen := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, album := range albums {
+		if seen[album.ID] || album.ID == "" {
+			continue
+		}
+		seen[album.ID] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			palette := app.albumPalette(ctx, album)
+			mu.Lock()
+			byID[album.ID] = palette
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	palettes := make([]*artwork.Palette, len(albums))
+	for i, album := range albums {
+		palettes[i] = byID[album.ID]
+	}
+	return palettes
+}
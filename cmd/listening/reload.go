@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/config"
+)
+
+// How often the config and keys files are checked for changes.
+const reloadInterval = 5 * time.Second
+
+// watchConfig reloads the configuration on SIGHUP or whenever the config or
+// keys file changes, until ctx is done.
+func (app *App) watchConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	changed := make(chan struct{}, 1)
+	paths := []string{app.cfg.Path, app.cfg.Auth.KeysFile}
+	go config.Watch(ctx, reloadInterval, paths, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			app.reload("SIGHUP")
+		case <-changed:
+			app.reload("file change")
+		}
+	}
+}
+
+// reload loads the configuration again and swaps in the settings that can
+// change at runtime. The Spotify token and cached values are left untouched.
+func (app *App) reload(reason string) {
+	log := app.log
+
+	cfg, err := config.Load(app.flags)
+	if err != nil {
+		log.Errorf("config reload on %s failed, keeping current config: %v", reason, err)
+		app.reloadErr.Store(&err)
+		return
+	}
+	app.reloadErr.Store(nil)
+
+	changes := config.Diff(app.cfg, cfg)
+	if len(changes) == 0 {
+		log.Infof("config reloaded on %s, nothing changed", reason)
+		return
+	}
+
+	if err := app.keys.Replace(cfg.Auth.Keys); err != nil {
+		log.Errorf("config reload on %s failed, keeping current config: %v", reason, err)
+		app.reloadErr.Store(&err)
+		return
+	}
+	app.cors.Replace(cfg.Origins, cfg.Cors)
+	trusted := cfg.TrustedProxies()
+	app.readLimiter.SetLimit(cfg.RateLimit.Read)
+	app.readLimiter.SetTrustedProxies(trusted)
+	app.controlLimiter.SetLimit(cfg.RateLimit.Control)
+	app.controlLimiter.SetTrustedProxies(trusted)
+	app.accessLog.SetConfig(cfg.AccessLog)
+	app.accessLog.SetTrustedProxies(trusted)
+	app.setCacheOptions(cfg.Cache)
+	app.art.SetMaxBytes(cfg.Art.CacheSize)
+
+	log.Infof("config reloaded on %s:", reason)
+	for _, change := range changes {
+		log.Infof("  %s", change)
+	}
+	if needsRestart(app.cfg, cfg) {
+		log.Warnf("changes to host, port, addr, spotify, auth.public_read, auth.device_login, auth.keys_file and tracing only fully apply after a restart")
+	}
+
+	app.cfg = cfg
+}
+
+func needsRestart(old *config.Config, new *config.Config) bool {
+	return old.Host != new.Host ||
+		old.Port != new.Port ||
+		old.Addr != new.Addr ||
+		old.Spotify != new.Spotify ||
+		old.Auth.PublicRead != new.Auth.PublicRead ||
+		old.Auth.DeviceLogin != new.Auth.DeviceLogin ||
+		old.Auth.KeysFile != new.Auth.KeysFile ||
+		old.Tracing != new.Tracing
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/apikey"
+	"github.com/shantanuraj/listening/pkg/config"
+	"github.com/shantanuraj/listening/pkg/diskcache"
+	"github.com/shantanuraj/listening/pkg/log"
+	"github.com/shantanuraj/listening/pkg/metrics"
+	"github.com/shantanuraj/listening/pkg/middleware"
+	"github.com/shantanuraj/listening/pkg/spotify"
+	"github.com/shantanuraj/listening/pkg/trace"
+)
+
+// How long in-flight requests get to finish once a shutdown signal arrives.
+const drainTimeout = 15 * time.Second
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("listening serve", flag.ContinueOnError)
+	flags := config.AddFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(flags)
+	if err != nil {
+		return err
+	}
+
+	log := log.New()
+	client := spotify.NewClient(cfg.Spotify)
+	app := newApp(client, log, cfg.Cache)
+	app.flags = flags
+	app.cfg = cfg
+
+	keys, err := apikey.NewStore(cfg.Auth.Keys)
+	if err != nil {
+		return fmt.Errorf("failed to load api keys: %w", err)
+	}
+	if keys.Len() == 0 {
+		log.Warnf("no api keys configured, control routes are disabled")
+	}
+	app.keys = keys
+
+	artDir, err := artCacheDir()
+	if err != nil {
+		return fmt.Errorf("failed to get art cache path: %w", err)
+	}
+	app.art, err = diskcache.Open(artDir, cfg.Art.CacheSize)
+	if err != nil {
+		return fmt.Errorf("failed to open art cache: %w", err)
+	}
+
+	var tracer *trace.Tracer
+	if cfg.Tracing.Enabled() {
+		exporter, err := trace.NewExporter(cfg.Tracing.ServiceName, cfg.Tracing.File, cfg.Tracing.Endpoint)
+		if err != nil {
+			return err
+		}
+		tracer = trace.NewTracer(cfg.Tracing.ServiceName, exporter)
+		trace.SetDefault(tracer)
+	}
+
+	trusted := cfg.TrustedProxies()
+	app.readLimiter = middleware.NewRateLimiter(cfg.RateLimit.Read, trusted)
+	app.controlLimiter = middleware.NewRateLimiter(cfg.RateLimit.Control, trusted)
+	limitRead := middleware.WithRateLimit(app.readLimiter)
+	limitControl := middleware.WithRateLimit(app.controlLimiter)
+
+	requireRead := func(h http.Handler) http.Handler {
+		return middleware.WithAPIKey(keys, apikey.ScopeRead, cfg.Auth.PublicRead, app.controlLimiter)(limitRead(h))
+	}
+	requireControl := func(h http.Handler) http.Handler {
+		return middleware.WithAPIKey(keys, apikey.ScopeControl, false, app.controlLimiter)(limitControl(h))
+	}
+	requireAdmin := func(h http.Handler) http.Handler {
+		return middleware.WithAPIKey(keys, apikey.ScopeAdmin, false, app.controlLimiter)(limitControl(h))
+	}
+
+	mux := http.NewServeMux()
+
+	if cfg.Auth.DeviceLogin {
+		deviceLogin, err := client.RegisterDeviceLoginHandlers(cfg.Addr, mux, limitControl, app.controlLimiter.ClientIP)
+		if err != nil {
+			return fmt.Errorf("failed to register authentication handlers: %w", err)
+		}
+		if !client.IsAuthenticated() && !client.IsTokenExpired() {
+			deviceLogin.Start()
+		}
+	} else if err := client.RegisterAuthenticationHandlers(cfg.Addr, mux); err != nil {
+		return fmt.Errorf("failed to register authentication handlers: %w", err)
+	}
+	mux.Handle("GET /current", requireRead(client.FeatureMiddleware(spotify.FeatureCurrent, app.currentTrackHandler)))
+	mux.Handle("GET /queue", requireRead(client.FeatureMiddleware(spotify.FeatureQueue, app.queueHandler)))
+	mux.Handle("GET /badge.svg", requireRead(client.FeatureMiddleware(spotify.FeatureCurrent, app.badgeHandler)))
+	mux.Handle("GET /art/{albumID}", requireRead(http.HandlerFunc(app.artHandler)))
+	mux.Handle("GET /recent", requireRead(client.FeatureMiddleware(spotify.FeatureRecent, app.recentHandler)))
+	mux.Handle("GET /top/artists", requireRead(client.FeatureMiddleware(spotify.FeatureTop, app.topArtistsHandler)))
+	mux.Handle("GET /top/tracks", requireRead(client.FeatureMiddleware(spotify.FeatureTop, app.topTracksHandler)))
+	mux.Handle("PUT /play", requireControl(client.FeatureMiddleware(spotify.FeaturePlay, app.playHandler)))
+	mux.Handle("POST /logout", requireAdmin(http.HandlerFunc(app.logoutHandler)))
+	mux.Handle("POST /refresh", requireAdmin(http.HandlerFunc(client.RefreshHandler)))
+	mux.Handle("GET /auth/status", requireAdmin(http.HandlerFunc(app.authStatusHandler)))
+	mux.Handle("GET /metrics", requireRead(metrics.Default.Handler()))
+	mux.HandleFunc("GET /healthz", app.healthzHandler)
+	mux.HandleFunc("GET /readyz", app.readyzHandler)
+
+	app.cors = middleware.NewCors(mux, cfg.Origins, cfg.Cors)
+	enableCors := middleware.WithCors(app.cors)
+	enableRequestID := middleware.WithRequestID()
+	enableTracing := middleware.WithTracing()
+	app.accessLog = middleware.NewAccessLog(log, os.Stdout, cfg.AccessLog, trusted)
+	enableLogging := middleware.WithLogging(app.accessLog)
+	enableCompression := middleware.WithCompression()
+
+	server := &http.Server{
+		Addr:              cfg.ListenAddr(),
+		Handler:           enableRequestID(enableTracing(enableCors(enableLogging(enableCompression(mux))))),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app.restoreCaches()
+	go app.watchConfig(ctx)
+
+	go func() {
+		log.Infof("listening on %s", cfg.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("failed to listen at %s %v", cfg.Addr, err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Infof("shutting down, draining requests for up to %v", drainTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("failed to drain requests: %v", err)
+	}
+
+	app.closeCaches()
+	app.saveCaches()
+
+	if tracer != nil {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		trace.SetDefault(nil)
+		tracer.Shutdown(flushCtx)
+	}
+
+	log.Infof("shut down")
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/shantanuraj/listening/pkg/funk"
+	"github.com/shantanuraj/listening/pkg/spotify"
+)
+
+func (app *App) topArtistsHandler(w http.ResponseWriter, r *http.Request) {
+	log := app.log.WithContext(r.Context())
+	query := r.URL.Query()
+
+	timeRange, err := spotify.ParseTimeRange(query.Get("time_range"))
+	if err != nil {
+		http.Error(w, "invalid time_range", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimit(query)
+	if err != nil {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := getCached(r, app.topArtists, timeRange)
+	if err != nil {
+		log.Errorf("failed to fetch top artists: %v", err)
+		http.Error(w, "failed to fetch top artists", http.StatusInternalServerError)
+		return
+	}
+	log.Infof("serving %s top artists (%s)", entry.State, timeRange)
+
+	top := *entry.Value
+	top.Items = funk.Range(top.Items, 0, limit)
+
+	writeCachedJSON(w, r, entry, top)
+}
+
+func (app *App) topTracksHandler(w http.ResponseWriter, r *http.Request) {
+	log := app.log.WithContext(r.Context())
+	query := r.URL.Query()
+
+	timeRange, err := spotify.ParseTimeRange(query.Get("time_range"))
+	if err != nil {
+		http.Error(w, "invalid time_range", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimit(query)
+	if err != nil {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := getCached(r, app.topTracks, timeRange)
+	if err != nil {
+		log.Errorf("failed to fetch top tracks: %v", err)
+		http.Error(w, "failed to fetch top tracks", http.StatusInternalServerError)
+		return
+	}
+	log.Infof("serving %s top tracks (%s)", entry.State, timeRange)
+
+	top := *entry.Value
+	top.Items = funk.Range(top.Items, 0, limit)
+
+	writeCachedJSON(w, r, entry, top)
+}
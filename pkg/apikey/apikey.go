@@ -0,0 +1,143 @@
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+)
+
+// Scope is a permission granted to an API key.
+type Scope string
+
+const (
+	ScopeRead    Scope = "read"    // Read listening data
+	ScopeControl Scope = "control" // Control playback, implies read
+	ScopeAdmin   Scope = "admin"   // Manage the server, implies control
+)
+
+var scopeRank = map[Scope]int{
+	ScopeRead:    1,
+	ScopeControl: 2,
+	ScopeAdmin:   3,
+}
+
+type Key struct {
+	Name   string  `json:"name"`
+	Key    string  `json:"key"`
+	Scopes []Scope `json:"scopes"`
+}
+
+// Allows reports whether k grants scope, either directly or through a
+// broader scope.
+func (k Key) Allows(scope Scope) bool {
+	return slices.ContainsFunc(k.Scopes, func(s Scope) bool {
+		return scopeRank[s] >= scopeRank[scope]
+	})
+}
+
+// Validate checks that k is usable.
+func (k Key) Validate() error {
+	if k.Name == "" {
+		return fmt.Errorf("api key without a name")
+	}
+	if len(k.Key) < 16 {
+		return fmt.Errorf("api key %q: key must be at least 16 characters", k.Name)
+	}
+	if len(k.Scopes) == 0 {
+		return fmt.Errorf("api key %q: no scopes", k.Name)
+	}
+	for _, s := range k.Scopes {
+		if _, ok := scopeRank[s]; !ok {
+			return fmt.Errorf("api key %q: unknown scope %q", k.Name, s)
+		}
+	}
+	return nil
+}
+
+// LoadFile reads a JSON array of keys from path.
+// A missing file is not an error and yields no keys.
+func LoadFile(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+type hashedKey struct {
+	key  Key
+	hash [sha256.Size]byte
+}
+
+// Store holds the set of valid keys and can be swapped atomically.
+type Store struct {
+	keys atomic.Pointer[[]hashedKey]
+}
+
+func NewStore(keys []Key) (*Store, error) {
+	s := &Store{}
+	if err := s.Replace(keys); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Replace validates keys and swaps them in for the current set.
+func (s *Store) Replace(keys []Key) error {
+	hashed := make([]hashedKey, 0, len(keys))
+	for _, k := range keys {
+		if err := k.Validate(); err != nil {
+			return err
+		}
+		hashed = append(hashed, hashedKey{key: k, hash: sha256.Sum256([]byte(k.Key))})
+	}
+	s.keys.Store(&hashed)
+	return nil
+}
+
+// Len returns the number of configured keys.
+func (s *Store) Len() int {
+	return len(*s.keys.Load())
+}
+
+// Lookup finds the key matching token. Every configured key is compared in
+// constant time so the response time does not leak which keys exist.
+func (s *Store) Lookup(token string) (Key, bool) {
+	candidate := sha256.Sum256([]byte(token))
+
+	var found Key
+	match := 0
+	for _, k := range *s.keys.Load() {
+		if subtle.ConstantTimeCompare(candidate[:], k.hash[:]) == 1 {
+			found = k.key
+			match = 1
+		}
+	}
+	return found, match == 1
+}
+
+type contextKey struct{}
+
+// WithKey returns a copy of ctx carrying the authenticated key.
+func WithKey(ctx context.Context, k Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, k)
+}
+
+// FromContext returns the authenticated key stored in ctx, if any.
+func FromContext(ctx context.Context) (Key, bool) {
+	k, ok := ctx.Value(contextKey{}).(Key)
+	return k, ok
+}
@@ -0,0 +1,84 @@
+package apikey
+
+import "testing"
+
+func TestStoreLookup(t *testing.T) {
+	store, err := NewStore([]Key{
+		{Name: "website", Key: "website-key-0123456789", Scopes: []Scope{ScopeRead}},
+		{Name: "phone", Key: "phone-key-0123456789", Scopes: []Scope{ScopeControl}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		token string
+		want  string
+		ok    bool
+	}{
+		{"website-key-0123456789", "website", true},
+		{"phone-key-0123456789", "phone", true},
+		{"", "", false},
+		{"website-key-012345678", "", false},
+		{"website-key-0123456789 ", "", false},
+		{"WEBSITE-KEY-0123456789", "", false},
+	}
+	for _, tt := range tests {
+		k, ok := store.Lookup(tt.token)
+		if ok != tt.ok || k.Name != tt.want {
+			t.Errorf("Lookup(%q) = %q, %v, want %q, %v", tt.token, k.Name, ok, tt.want, tt.ok)
+		}
+	}
+
+	if err := store.Replace(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Lookup("website-key-0123456789"); ok {
+		t.Error("Lookup succeeded after the keys were replaced")
+	}
+}
+
+func TestKeyAllows(t *testing.T) {
+	tests := []struct {
+		scopes []Scope
+		scope  Scope
+		want   bool
+	}{
+		{[]Scope{ScopeRead}, ScopeRead, true},
+		{[]Scope{ScopeRead}, ScopeControl, false},
+		{[]Scope{ScopeRead}, ScopeAdmin, false},
+		{[]Scope{ScopeControl}, ScopeRead, true},
+		{[]Scope{ScopeControl}, ScopeControl, true},
+		{[]Scope{ScopeControl}, ScopeAdmin, false},
+		{[]Scope{ScopeAdmin}, ScopeRead, true},
+		{[]Scope{ScopeAdmin}, ScopeAdmin, true},
+		{[]Scope{ScopeRead, ScopeAdmin}, ScopeControl, true},
+		{nil, ScopeRead, false},
+		{[]Scope{"unknown"}, ScopeRead, false},
+	}
+	for _, tt := range tests {
+		k := Key{Name: "test", Scopes: tt.scopes}
+		if got := k.Allows(tt.scope); got != tt.want {
+			t.Errorf("%v.Allows(%q) = %v, want %v", tt.scopes, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestKeyValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   Key
+		valid bool
+	}{
+		{"valid", Key{Name: "a", Key: "0123456789abcdef", Scopes: []Scope{ScopeRead}}, true},
+		{"no name", Key{Key: "0123456789abcdef", Scopes: []Scope{ScopeRead}}, false},
+		{"short key", Key{Name: "a", Key: "0123456789abcde", Scopes: []Scope{ScopeRead}}, false},
+		{"no scopes", Key{Name: "a", Key: "0123456789abcdef"}, false},
+		{"unknown scope", Key{Name: "a", Key: "0123456789abcdef", Scopes: []Scope{"write"}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.key.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package artwork
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"sync"
+)
+
+// Palette is a set of colours picked from album art to theme a page around
+// it, as #rrggbb strings.
+type Palette struct {
+	// Dominant is the most common colour.
+	Dominant string `json:"dominant"`
+	// Vibrant is a common saturated colour, for accents.
+	Vibrant string `json:"vibrant"`
+	// Muted is a common desaturated colour, for backgrounds.
+	Muted string `json:"muted"`
+	// Text is black or white, whichever contrasts more with Dominant. Either
+	// way it meets the WCAG AA contrast ratio of 4.5:1.
+	Text string `json:"text"`
+}
+
+// paletteSampleSize is the width images are shrunk to before sampling,
+// which is plenty for picking colours and keeps extraction fast.
+const paletteSampleSize = 64
+
+// DecodePalette decodes a JPEG or PNG image and extracts its palette.
+func DecodePalette(data []byte) (Palette, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Palette{}, err
+	}
+	return ExtractPalette(img), nil
+}
+
+type swatch struct {
+	n       int
+	r, g, b int
+	s, l    float64
+}
+
+func (s swatch) color() color.RGBA {
+	return color.RGBA{uint8(s.r / s.n), uint8(s.g / s.n), uint8(s.b / s.n), 255}
+}
+
+// ExtractPalette picks the palette of img by grouping its pixels into
+// buckets of similar colours and scoring each bucket by how many pixels
+// it holds and how well its average colour fits each role.
+func ExtractPalette(img image.Image) Palette {
+	if bounds := img.Bounds(); bounds.Dx() > paletteSampleSize {
+		height := max(1, bounds.Dy()*paletteSampleSize/bounds.Dx())
+		img = resize(img, paletteSampleSize, height)
+	}
+
+	// 4 bits per channel
+	var buckets [4096]swatch
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 {
+				continue
+			}
+			b := &buckets[int(c.R>>4)<<8|int(c.G>>4)<<4|int(c.B>>4)]
+			b.n++
+			b.r, b.g, b.b = b.r+int(c.R), b.g+int(c.G), b.b+int(c.B)
+		}
+	}
+
+	var dominant, vibrant, muted *swatch
+	var vibrantScore, mutedScore float64
+	for i := range buckets {
+		b := &buckets[i]
+		if b.n == 0 {
+			continue
+		}
+		b.s, b.l = saturationLightness(b.color())
+
+		if dominant == nil || b.n > dominant.n {
+			dominant = b
+		}
+		// Prefer colours away from black and white for both roles
+		balance := 1 - math.Abs(b.l-0.5)*2
+		if b.s >= 0.35 && b.l >= 0.25 && b.l <= 0.75 {
+			if score := float64(b.n) * b.s * balance; score > vibrantScore {
+				vibrant, vibrantScore = b, score
+			}
+		}
+		if b.s < 0.35 && b.l >= 0.2 && b.l <= 0.8 {
+			if score := float64(b.n) * balance; score > mutedScore {
+				muted, mutedScore = b, score
+			}
+		}
+	}
+
+	if dominant == nil {
+		// Nothing opaque to pick from
+		return Palette{Dominant: "#000000", Vibrant: "#000000", Muted: "#000000", Text: "#ffffff"}
+	}
+	if vibrant == nil {
+		vibrant = dominant
+	}
+	if muted == nil {
+		muted = dominant
+	}
+
+	text := "#000000"
+	if l := luminance(dominant.color()); contrast(l, 1) > contrast(l, 0) {
+		text = "#ffffff"
+	}
+
+	return Palette{
+		Dominant: hex(dominant.color()),
+		Vibrant:  hex(vibrant.color()),
+		Muted:    hex(muted.color()),
+		Text:     text,
+	}
+}
+
+// saturationLightness returns the HSL saturation and lightness of c.
+func saturationLightness(c color.RGBA) (float64, float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	hi, lo := max(r, g, b), min(r, g, b)
+	l := (hi + lo) / 2
+	if hi == lo {
+		return 0, l
+	}
+	if l > 0.5 {
+		return (hi - lo) / (2 - hi - lo), l
+	}
+	return (hi - lo) / (hi + lo), l
+}
+
+// luminance is the WCAG relative luminance of c.
+func luminance(c color.RGBA) float64 {
+	linear := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(c.R) + 0.7152*linear(c.G) + 0.0722*linear(c.B)
+}
+
+// contrast is the WCAG contrast ratio between two relative luminances.
+func contrast(a float64, b float64) float64 {
+	return (max(a, b) + 0.05) / (min(a, b) + 0.05)
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// Palettes is an in-memory LRU cache of palettes keyed by album ID.
+type Palettes struct {
+	max int
+
+	mu      sync.Mutex
+	order   *list.List // Most recently used first
+	entries map[string]*list.Element
+}
+
+type paletteEntry struct {
+	albumID string
+	palette Palette
+}
+
+// NewPalettes returns a cache holding the palettes of up to max albums.
+func NewPalettes(max int) *Palettes {
+	return &Palettes{
+		max:     max,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (p *Palettes) Get(albumID string) (Palette, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	el, ok := p.entries[albumID]
+	if !ok {
+		return Palette{}, false
+	}
+	p.order.MoveToFront(el)
+	return el.Value.(*paletteEntry).palette, true
+}
+
+func (p *Palettes) Add(albumID string, palette Palette) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if el, ok := p.entries[albumID]; ok {
+		el.Value.(*paletteEntry).palette = palette
+		p.order.MoveToFront(el)
+		return
+	}
+	p.entries[albumID] = p.order.PushFront(&paletteEntry{albumID: albumID, palette: palette})
+	for p.order.Len() > p.max {
+		oldest := p.order.Back()
+		p.order.Remove(oldest)
+		delete(p.entries, oldest.Value.(*paletteEntry).albumID)
+	}
+}
+
+// Purge drops every cached palette.
+func (p *Palettes) Purge() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.order.Init()
+	clear(p.entries)
+}
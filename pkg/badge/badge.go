@@ -0,0 +1,188 @@
+package badge
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type Theme string
+
+const (
+	ThemeLight   Theme = "light"
+	ThemeDark    Theme = "dark"
+	ThemeCompact Theme = "compact"
+)
+
+// ParseTheme parses the theme query parameter, defaulting to light.
+func ParseTheme(s string) (Theme, error) {
+	switch theme := Theme(s); theme {
+	case "":
+		return ThemeLight, nil
+	case ThemeLight, ThemeDark, ThemeCompact:
+		return theme, nil
+	default:
+		return "", fmt.Errorf("invalid theme: %q", s)
+	}
+}
+
+// Badge is what the badge shows. An empty Title renders the idle state.
+type Badge struct {
+	Playing  bool
+	Title    string
+	Artists  []string
+	Progress time.Duration
+	Duration time.Duration
+	// Art is the album art as a data URI, or empty to leave it out.
+	Art string
+}
+
+type palette struct {
+	Background string
+	Border     string
+	Text       string
+	Muted      string
+	Track      string
+	Accent     string
+}
+
+var palettes = map[Theme]palette{
+	ThemeLight:   {Background: "#ffffff", Border: "#e1e4e8", Text: "#24292e", Muted: "#586069", Track: "#e1e4e8", Accent: "#1db954"},
+	ThemeDark:    {Background: "#0d1117", Border: "#30363d", Text: "#c9d1d9", Muted: "#8b949e", Track: "#30363d", Accent: "#1db954"},
+	ThemeCompact: {Background: "#ffffff", Border: "#e1e4e8", Text: "#24292e", Muted: "#586069", Track: "#e1e4e8", Accent: "#1db954"},
+}
+
+const (
+	progressFull = 290
+	progressMini = 340
+)
+
+var funcs = template.FuncMap{
+	"xml":      escape,
+	"truncate": truncate,
+}
+
+var fullTemplate = template.Must(template.New("full").Funcs(funcs).Parse(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="420" height="110" viewBox="0 0 420 110" role="img" aria-label="{{xml .Label}}">
+<title>{{xml .Label}}</title>
+<style>text{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",Helvetica,Arial,sans-serif}</style>
+<rect x="0.5" y="0.5" width="419" height="109" rx="8" fill="{{.P.Background}}" stroke="{{.P.Border}}"/>
+{{- if .Art}}
+<clipPath id="art"><rect x="15" y="15" width="80" height="80" rx="4"/></clipPath>
+<image x="15" y="15" width="80" height="80" clip-path="url(#art)" preserveAspectRatio="xMidYMid slice" href="{{xml .Art}}" xlink:href="{{xml .Art}}"/>
+{{- else}}
+<rect x="15" y="15" width="80" height="80" rx="4" fill="{{.P.Track}}"/>
+{{- end}}
+<text x="110" y="30" font-size="11" font-weight="600" letter-spacing="1" fill="{{if .Playing}}{{.P.Accent}}{{else}}{{.P.Muted}}{{end}}">{{xml .State}}</text>
+{{- if .Title}}
+<text x="110" y="52" font-size="16" font-weight="600" fill="{{.P.Text}}">{{xml (truncate .Title 34)}}</text>
+<text x="110" y="72" font-size="13" fill="{{.P.Muted}}">{{xml (truncate .Artists 42)}}</text>
+<rect x="110" y="84" width="{{.TrackWidth}}" height="4" rx="2" fill="{{.P.Track}}"/>
+<rect x="110" y="84" width="{{.ProgressWidth}}" height="4" rx="2" fill="{{.P.Accent}}"/>
+<text x="110" y="101" font-size="10" fill="{{.P.Muted}}">{{.Progress}}</text>
+<text x="400" y="101" font-size="10" text-anchor="end" fill="{{.P.Muted}}">{{.Duration}}</text>
+{{- end}}
+</svg>
+`))
+
+var compactTemplate = template.Must(template.New("compact").Funcs(funcs).Parse(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="340" height="28" viewBox="0 0 340 28" role="img" aria-label="{{xml .Label}}">
+<title>{{xml .Label}}</title>
+<style>text{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",Helvetica,Arial,sans-serif}</style>
+<rect x="0.5" y="0.5" width="339" height="27" rx="4" fill="{{.P.Background}}" stroke="{{.P.Border}}"/>
+{{- if .Art}}
+<image x="4" y="4" width="20" height="20" preserveAspectRatio="xMidYMid slice" href="{{xml .Art}}" xlink:href="{{xml .Art}}"/>
+{{- end}}
+{{- if .Playing}}
+<path d="M32 9 L32 19 L40 14 Z" fill="{{.P.Accent}}"/>
+{{- else}}
+<rect x="32" y="9" width="3" height="10" fill="{{.P.Muted}}"/><rect x="37" y="9" width="3" height="10" fill="{{.P.Muted}}"/>
+{{- end}}
+<text x="48" y="18" font-size="12" fill="{{.P.Text}}">{{if .Title}}{{xml (truncate .Line 44)}}{{else}}{{xml .State}}{{end}}</text>
+{{- if .Title}}
+<rect x="0" y="26" width="{{.ProgressWidth}}" height="2" fill="{{.P.Accent}}"/>
+{{- end}}
+</svg>
+`))
+
+// Render writes b as an SVG in theme.
+func Render(w io.Writer, theme Theme, b Badge) error {
+	p, ok := palettes[theme]
+	if !ok {
+		return fmt.Errorf("invalid theme: %q", theme)
+	}
+
+	state := "NOT PLAYING"
+	switch {
+	case b.Title != "" && b.Playing:
+		state = "NOW PLAYING"
+	case b.Title != "":
+		state = "PAUSED"
+	}
+	artists := strings.Join(b.Artists, ", ")
+	line := b.Title
+	if artists != "" {
+		line += " — " + artists
+	}
+	label := state
+	if b.Title != "" {
+		label += ": " + line
+	}
+
+	tmpl, trackWidth := fullTemplate, progressFull
+	if theme == ThemeCompact {
+		tmpl, trackWidth = compactTemplate, progressMini
+	}
+
+	return tmpl.Execute(w, struct {
+		Badge
+		P             palette
+		State         string
+		Label         string
+		Line          string
+		Artists       string
+		TrackWidth    int
+		ProgressWidth string
+		Progress      string
+		Duration      string
+	}{
+		Badge:         b,
+		P:             p,
+		State:         state,
+		Label:         label,
+		Line:          line,
+		Artists:       artists,
+		TrackWidth:    trackWidth,
+		ProgressWidth: fmt.Sprintf("%.1f", progressFraction(b)*float64(trackWidth)),
+		Progress:      formatDuration(b.Progress),
+		Duration:      formatDuration(b.Duration),
+	})
+}
+
+func progressFraction(b Badge) float64 {
+	if b.Duration <= 0 {
+		return 0
+	}
+	return min(max(float64(b.Progress)/float64(b.Duration), 0), 1)
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// truncate shortens s to n runes, ending it with an ellipsis when cut.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SetHeaders sets Last-Modified and Cache-Control on h so that browsers and
+// CDNs mirror the server-side freshness of entry. Private responses, such
+// as those to requests authorized with an API key, are kept out of shared
+// caches.
+func (e Entry[V]) SetHeaders(h http.Header, private bool) {
+	h.Set("Last-Modified", e.FetchedAt.UTC().Format(http.TimeFormat))
+	h.Set("Cache-Control", e.CacheControl(private))
+	h.Add("Vary", "Authorization")
+}
+
+// CacheControl returns a Cache-Control value with max-age set to the remaining
+// fresh lifetime of entry and stale-while-revalidate to its stale window.
+func (e Entry[V]) CacheControl(private bool) string {
+	maxAge := max(time.Until(e.FreshUntil), 0)
+	if e.State == Stale {
+		maxAge = 0
+	}
+	staleWhileRevalidate := e.StaleUntil.Sub(e.FreshUntil)
+	scope := "public"
+	if private {
+		scope = "private"
+	}
+	return fmt.Sprintf(
+		"%s, max-age=%d, stale-while-revalidate=%d",
+		scope,
+		int(maxAge.Seconds()),
+		int(staleWhileRevalidate.Seconds()),
+	)
+}
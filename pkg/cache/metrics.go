@@ -0,0 +1,10 @@
+package cache
+
+import "github.com/shantanuraj/listening/pkg/metrics"
+
+var (
+	cacheRequests  = metrics.NewCounter("listening_cache_requests_total", "Cache reads by cache and the state they were served in.", "cache", "state")
+	cacheFetches   = metrics.NewCounter("listening_cache_fetches_total", "Upstream fetches started by cache.", "cache")
+	cacheCoalesced = metrics.NewCounter("listening_cache_coalesced_total", "Cache reads that shared a fetch already in flight.", "cache")
+	cacheThrottled = metrics.NewCounter("listening_cache_throttled_total", "Fetches skipped because of the minimum revalidation interval.", "cache")
+)
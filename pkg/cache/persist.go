@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type savedEntry[K comparable, V any] struct {
+	Key       K         `json:"key"`
+	Value     V         `json:"value"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// Save writes the cached values to w as JSON so they can be restored with
+// Load after a restart.
+func (c *SWR[K, V]) Save(w io.Writer) error {
+	c.mu.Lock()
+	saved := make([]savedEntry[K, V], 0, len(c.slots))
+	for key, s := range c.slots {
+		if s.ok {
+			saved = append(saved, savedEntry[K, V]{Key: key, Value: s.value, FetchedAt: s.fetchedAt})
+		}
+	}
+	c.mu.Unlock()
+
+	return json.NewEncoder(w).Encode(saved)
+}
+
+// Load restores values written by Save. Values older than MaxAge are skipped
+// and values already in the cache are kept if they are newer.
+func (c *SWR[K, V]) Load(r io.Reader) error {
+	var saved []savedEntry[K, V]
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+
+	maxAge := c.Options().MaxAge
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range saved {
+		if time.Since(e.FetchedAt) >= maxAge {
+			continue
+		}
+		s := c.slotLocked(e.Key)
+		if s.ok && !s.fetchedAt.Before(e.FetchedAt) {
+			continue
+		}
+		s.value, s.fetchedAt, s.ok = e.Value, e.FetchedAt, true
+	}
+	return nil
+}
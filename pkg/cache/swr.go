@@ -0,0 +1,377 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/log"
+	"github.com/shantanuraj/listening/pkg/trace"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// State describes how a cached value was obtained when it was served.
+type State int
+
+const (
+	Miss  State = iota // Value was fetched synchronously
+	Fresh              // Value was within its fresh TTL
+	Stale              // Value was past its fresh TTL and served while revalidating
+
+	numStates
+)
+
+func (s State) String() string {
+	switch s {
+	case Fresh:
+		return "fresh"
+	case Stale:
+		return "stale"
+	default:
+		return "miss"
+	}
+}
+
+type Options struct {
+	// Name identifies the cache in logs.
+	Name string
+	// FreshTTL is how long a value is served without being revalidated.
+	FreshTTL time.Duration
+	// StaleTTL is how long after FreshTTL a value is still served while it is
+	// revalidated in the background.
+	StaleTTL time.Duration
+	// MaxAge is how old a value may be and still be served when a synchronous
+	// fetch fails. Defaults to FreshTTL + StaleTTL.
+	MaxAge time.Duration
+	// MinInterval is the minimum time between upstream fetches for a key,
+	// including forced refreshes and retries after a failed fetch.
+	MinInterval time.Duration
+	// Timeout bounds each upstream fetch. Defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// Fetcher loads the value for key from upstream.
+type Fetcher[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// Entry is a value served from the cache along with its metadata.
+type Entry[V any] struct {
+	Value      V
+	FetchedAt  time.Time
+	FreshUntil time.Time // When the value stops being served without revalidation
+	StaleUntil time.Time // When the value stops being served while revalidating
+	State      State
+}
+
+// Stats are running totals of upstream activity for a cache.
+type Stats struct {
+	Fresh     uint64 // Requests served a fresh value
+	Stale     uint64 // Requests served a stale value
+	Misses    uint64 // Requests that waited on an upstream fetch
+	Errors    uint64 // Requests that failed without a value to fall back on
+	Fetches   uint64 // Upstream fetches started
+	Coalesced uint64 // Requests that shared a fetch already in flight
+	Throttled uint64 // Fetches skipped because of MinInterval
+}
+
+// SWR is a stale-while-revalidate cache keyed by K.
+// Concurrent fetches for the same key share a single upstream call, and
+// fetches are detached from the caller's context so that a client hanging up
+// does not cancel a revalidation other requests are relying on.
+type SWR[K comparable, V any] struct {
+	fetch Fetcher[K, V]
+	opts  atomic.Pointer[Options]
+
+	mu    sync.Mutex
+	slots map[K]*slot[V]
+
+	states    [numStates]atomic.Uint64
+	errors    atomic.Uint64
+	fetches   atomic.Uint64
+	coalesced atomic.Uint64
+	throttled atomic.Uint64
+
+	closing context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+// slot holds everything the cache knows about a single key.
+type slot[V any] struct {
+	value     V
+	fetchedAt time.Time
+	ok        bool
+
+	call       *call[V]
+	attemptAt  time.Time
+	attemptErr error
+}
+
+type call[V any] struct {
+	done      chan struct{}
+	shared    int
+	value     V
+	fetchedAt time.Time
+	err       error
+}
+
+func New[K comparable, V any](fetch Fetcher[K, V], opts Options) *SWR[K, V] {
+	closing, cancel := context.WithCancel(context.Background())
+	c := &SWR[K, V]{
+		fetch:   fetch,
+		slots:   make(map[K]*slot[V]),
+		closing: closing,
+		cancel:  cancel,
+	}
+	c.SetOptions(opts)
+	return c
+}
+
+// Options returns the options the cache is currently using.
+func (c *SWR[K, V]) Options() Options {
+	return *c.opts.Load()
+}
+
+// SetOptions replaces the options of the cache without dropping any values.
+func (c *SWR[K, V]) SetOptions(opts Options) {
+	if opts.MaxAge < opts.FreshTTL+opts.StaleTTL {
+		opts.MaxAge = opts.FreshTTL + opts.StaleTTL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	c.opts.Store(&opts)
+}
+
+// Stats returns the running totals for the cache.
+func (c *SWR[K, V]) Stats() Stats {
+	return Stats{
+		Fresh:     c.states[Fresh].Load(),
+		Stale:     c.states[Stale].Load(),
+		Misses:    c.states[Miss].Load(),
+		Errors:    c.errors.Load(),
+		Fetches:   c.fetches.Load(),
+		Coalesced: c.coalesced.Load(),
+		Throttled: c.throttled.Load(),
+	}
+}
+
+// Get returns the cached value for key, fetching it when it is missing or
+// too old to be served and revalidating it in the background when stale.
+func (c *SWR[K, V]) Get(ctx context.Context, key K) (entry Entry[V], err error) {
+	opts := c.Options()
+
+	ctx, span := trace.Start(ctx, "cache.get "+opts.Name, trace.KindInternal)
+	defer func() { endSpan(span, entry, err) }()
+
+	c.mu.Lock()
+	s := c.slotLocked(key)
+	if s.ok {
+		age := time.Since(s.fetchedAt)
+		switch {
+		case age < opts.FreshTTL:
+			entry := c.newEntry(s.value, s.fetchedAt, Fresh)
+			c.mu.Unlock()
+			return c.served(entry, nil)
+		case age < opts.FreshTTL+opts.StaleTTL:
+			if s.call != nil {
+				s.call.shared++
+				c.coalesced.Add(1)
+				cacheCoalesced.Inc(opts.Name)
+			} else if !c.throttledLocked(s) {
+				c.startLocked(ctx, key, s)
+			}
+			entry := c.newEntry(s.value, s.fetchedAt, Stale)
+			c.mu.Unlock()
+			return c.served(entry, nil)
+		case age >= opts.MaxAge:
+			var zero V
+			s.value, s.ok = zero, false
+		}
+	}
+
+	stale, hasStale := c.newEntry(s.value, s.fetchedAt, Stale), s.ok
+	cl, err := c.joinLocked(ctx, key, s)
+	c.mu.Unlock()
+
+	if err == nil {
+		entry, err = c.wait(ctx, cl)
+	}
+	if err != nil && hasStale {
+		log.WithContext(ctx).Warnf("cache(%s): serving stale value after failed fetch: %v", opts.Name, err)
+		return c.served(stale, nil)
+	}
+	return c.served(entry, err)
+}
+
+// Refresh fetches the value for key from upstream regardless of its age,
+// unless a fetch is already in flight or one happened within MinInterval.
+func (c *SWR[K, V]) Refresh(ctx context.Context, key K) (entry Entry[V], err error) {
+	ctx, span := trace.Start(ctx, "cache.refresh "+c.Options().Name, trace.KindInternal)
+	defer func() { endSpan(span, entry, err) }()
+
+	c.mu.Lock()
+	s := c.slotLocked(key)
+	if s.call == nil && s.ok && c.throttledLocked(s) && s.attemptErr == nil {
+		entry := c.newEntry(s.value, s.fetchedAt, Fresh)
+		c.mu.Unlock()
+		return c.served(entry, nil)
+	}
+	cl, err := c.joinLocked(ctx, key, s)
+	c.mu.Unlock()
+
+	if err != nil {
+		return c.served(Entry[V]{}, err)
+	}
+	return c.served(c.wait(ctx, cl))
+}
+
+func endSpan[V any](span *trace.Span, entry Entry[V], err error) {
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttributes(trace.Attr{Key: "cache.state", Value: entry.State.String()})
+	}
+	span.End()
+}
+
+// served counts how a request was answered before handing back its result.
+func (c *SWR[K, V]) served(entry Entry[V], err error) (Entry[V], error) {
+	name := c.Options().Name
+	if err != nil {
+		c.errors.Add(1)
+		cacheRequests.Inc(name, "error")
+		return entry, err
+	}
+	c.states[entry.State].Add(1)
+	cacheRequests.Inc(name, entry.State.String())
+	return entry, nil
+}
+
+// Delete removes the cached value for key.
+func (c *SWR[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.slots, key)
+}
+
+// Purge removes all cached values.
+func (c *SWR[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.slots)
+}
+
+// Close cancels fetches that are in flight and waits for them to return.
+func (c *SWR[K, V]) Close() {
+	c.cancel()
+	c.running.Wait()
+}
+
+func (c *SWR[K, V]) newEntry(value V, fetchedAt time.Time, state State) Entry[V] {
+	opts := c.Options()
+	return Entry[V]{
+		Value:      value,
+		FetchedAt:  fetchedAt,
+		FreshUntil: fetchedAt.Add(opts.FreshTTL),
+		StaleUntil: fetchedAt.Add(opts.FreshTTL + opts.StaleTTL),
+		State:      state,
+	}
+}
+
+func (c *SWR[K, V]) slotLocked(key K) *slot[V] {
+	s, ok := c.slots[key]
+	if !ok {
+		s = &slot[V]{}
+		c.slots[key] = s
+	}
+	return s
+}
+
+// throttledLocked reports whether a fetch for s would violate MinInterval,
+// counting it if so. c.mu must be held.
+func (c *SWR[K, V]) throttledLocked(s *slot[V]) bool {
+	minInterval := c.Options().MinInterval
+	if minInterval <= 0 || s.attemptAt.IsZero() || time.Since(s.attemptAt) >= minInterval {
+		return false
+	}
+	c.throttled.Add(1)
+	cacheThrottled.Inc(c.Options().Name)
+	return true
+}
+
+// joinLocked returns the in-flight call for s, starting one unless the last
+// attempt failed within MinInterval, in which case that error is returned.
+// c.mu must be held.
+func (c *SWR[K, V]) joinLocked(ctx context.Context, key K, s *slot[V]) (*call[V], error) {
+	if s.call != nil {
+		s.call.shared++
+		c.coalesced.Add(1)
+		cacheCoalesced.Inc(c.Options().Name)
+		return s.call, nil
+	}
+	if s.attemptErr != nil && c.throttledLocked(s) {
+		return nil, s.attemptErr
+	}
+	return c.startLocked(ctx, key, s), nil
+}
+
+// startLocked starts a fetch for s. c.mu must be held.
+func (c *SWR[K, V]) startLocked(ctx context.Context, key K, s *slot[V]) *call[V] {
+	cl := &call[V]{done: make(chan struct{})}
+	s.call = cl
+	s.attemptAt = time.Now()
+	c.fetches.Add(1)
+	cacheFetches.Inc(c.Options().Name)
+	c.running.Add(1)
+	go c.run(context.WithoutCancel(ctx), key, s, cl)
+	return cl
+}
+
+func (c *SWR[K, V]) wait(ctx context.Context, cl *call[V]) (Entry[V], error) {
+	select {
+	case <-cl.done:
+	case <-ctx.Done():
+		return Entry[V]{}, ctx.Err()
+	}
+	if cl.err != nil {
+		return Entry[V]{}, cl.err
+	}
+	return c.newEntry(cl.value, cl.fetchedAt, Miss), nil
+}
+
+func (c *SWR[K, V]) run(ctx context.Context, key K, s *slot[V], cl *call[V]) {
+	defer c.running.Done()
+
+	opts := c.Options()
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	stop := context.AfterFunc(c.closing, cancel)
+	defer stop()
+
+	ctx, span := trace.Start(ctx, "cache.fetch "+opts.Name, trace.KindInternal)
+	start := time.Now()
+	value, err := c.fetch(ctx, key)
+	fetchedAt := time.Now()
+	span.RecordError(err)
+	span.End()
+
+	c.mu.Lock()
+	if err == nil {
+		s.value, s.fetchedAt, s.ok = value, fetchedAt, true
+	}
+	s.call, s.attemptErr = nil, err
+	shared := cl.shared
+	c.mu.Unlock()
+
+	log := log.WithContext(ctx)
+	if err != nil {
+		log.Errorf("cache(%s): fetch failed after %v, coalesced %d requests: %v", opts.Name, fetchedAt.Sub(start), shared, err)
+	} else if shared > 0 {
+		log.Infof("cache(%s): fetched in %v, coalesced %d requests", opts.Name, fetchedAt.Sub(start), shared)
+	}
+
+	cl.value, cl.fetchedAt, cl.err = value, fetchedAt, err
+	close(cl.done)
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/apikey"
+)
+
+type Config struct {
+	// Host is the interface the server listens on.
+	Host string `json:"host"`
+	// Port is the port the server listens on.
+	Port int `json:"port"`
+	// Addr is the public address Spotify redirects to after the OAuth flow.
+	// Defaults to http://Host:Port.
+	Addr string `json:"addr"`
+	// Origins are the origins allowed by the CORS policy, such as
+	// https://example.com, https://*.example.com for any subdomain, or *.
+	Origins []string `json:"origins"`
+	Cors    Cors     `json:"cors"`
+
+	Spotify   Spotify    `json:"spotify"`
+	Auth      Auth       `json:"auth"`
+	RateLimit RateLimits `json:"rate_limit"`
+	Cache     Caches     `json:"cache"`
+	AccessLog AccessLog  `json:"access_log"`
+	Tracing   Tracing    `json:"tracing"`
+	Art       Art        `json:"art"`
+
+	// Path is the config file the configuration was loaded from, which may
+	// not exist.
+	Path string `json:"-"`
+}
+
+type Spotify struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+type Auth struct {
+	// PublicRead allows read routes to be accessed without an API key.
+	PublicRead bool `json:"public_read"`
+	// KeysFile is a JSON file of additional API keys.
+	KeysFile string `json:"keys_file"`
+	// Keys are API keys defined inline in the config file.
+	Keys []apikey.Key `json:"keys"`
+	// DeviceLogin replaces the open OAuth redirect with a relay page that
+	// requires a one-time code printed by the server.
+	DeviceLogin bool `json:"device_login"`
+}
+
+type RateLimits struct {
+	// TrustedProxies are IPs or CIDRs whose X-Forwarded-For header is honoured.
+	TrustedProxies []string  `json:"trusted_proxies"`
+	Read           RateLimit `json:"read"`
+	Control        RateLimit `json:"control"`
+}
+
+type RateLimit struct {
+	// PerMinute is the sustained number of requests allowed per minute.
+	PerMinute float64 `json:"per_minute"`
+	// Burst is the number of requests that can be made at once.
+	Burst int `json:"burst"`
+}
+
+type Caches struct {
+	Current Cache `json:"current"`
+	Queue   Cache `json:"queue"`
+	Recent  Cache `json:"recent"`
+	Top     Cache `json:"top"`
+}
+
+type Cache struct {
+	Fresh       Duration `json:"fresh"`
+	Stale       Duration `json:"stale"`
+	MinInterval Duration `json:"min_interval"`
+}
+
+type Cors struct {
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge Duration `json:"max_age"`
+	// AllowHeaders are the request headers cross-origin requests may send.
+	AllowHeaders []string `json:"allow_headers"`
+	// ExposeHeaders are the response headers scripts on allowed origins can
+	// read besides the CORS-safelisted ones.
+	ExposeHeaders []string `json:"expose_headers"`
+	// Routes maps paths to the origins allowed on them instead of Origins.
+	// A path ending in / also matches everything below it.
+	Routes map[string][]string `json:"routes"`
+}
+
+// AccessLogFormats are the formats the access log can be written in.
+var AccessLogFormats = []string{"log", "common", "combined", "json"}
+
+type AccessLog struct {
+	// Format is "log" to write through the application logger, "common" or
+	// "combined" for the Apache log formats, or "json" for one object per line.
+	Format string `json:"format"`
+	// Exclude are paths that are never logged. A path ending in / also
+	// excludes everything below it.
+	Exclude []string `json:"exclude"`
+	// Sample maps paths, matched like Exclude, to the fraction of their
+	// requests that are logged. Server errors are always logged.
+	Sample map[string]float64 `json:"sample"`
+}
+
+type Tracing struct {
+	// ServiceName is reported as service.name on exported spans.
+	ServiceName string `json:"service_name"`
+	// File is where spans are appended as OTLP/JSON, one request per line.
+	File string `json:"file"`
+	// Endpoint is an OTLP/HTTP collector spans are posted to as JSON, such
+	// as http://localhost:4318. /v1/traces is appended when it has no path.
+	Endpoint string `json:"endpoint"`
+}
+
+// Enabled reports whether spans should be recorded.
+func (t Tracing) Enabled() bool {
+	return t.File != "" || t.Endpoint != ""
+}
+
+type Art struct {
+	// CacheSize is how many bytes of album art are kept on disk.
+	CacheSize int64 `json:"cache_size"`
+}
+
+// Duration is a time.Duration written as a string like "5s" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func Default() *Config {
+	return &Config{
+		Host: "localhost",
+		Port: 5050,
+		Origins: []string{
+			"http://localhost:4321",
+			"https://sraj.me",
+		},
+		Cors: Cors{
+			MaxAge:        Duration(10 * time.Minute),
+			AllowHeaders:  []string{"Authorization", "Content-Type", "X-Request-ID", "traceparent"},
+			ExposeHeaders: []string{"ETag", "Link", "Retry-After", "X-Request-ID"},
+		},
+		Auth: Auth{
+			PublicRead: true,
+		},
+		RateLimit: RateLimits{
+			Read:    RateLimit{PerMinute: 60, Burst: 20},
+			Control: RateLimit{PerMinute: 10, Burst: 5},
+		},
+		Cache: Caches{
+			Current: Cache{Fresh: Duration(5 * time.Second), Stale: Duration(time.Hour), MinInterval: Duration(2 * time.Second)},
+			Queue:   Cache{Fresh: Duration(10 * time.Second), Stale: Duration(time.Hour), MinInterval: Duration(2 * time.Second)},
+			Recent:  Cache{Fresh: Duration(30 * time.Second), Stale: Duration(time.Hour), MinInterval: Duration(5 * time.Second)},
+			Top:     Cache{Fresh: Duration(6 * time.Hour), Stale: Duration(24 * time.Hour), MinInterval: Duration(time.Minute)},
+		},
+		Tracing: Tracing{
+			ServiceName: "listening",
+		},
+		AccessLog: AccessLog{
+			Format:  "log",
+			Exclude: []string{"/healthz", "/readyz"},
+		},
+		Art: Art{
+			CacheSize: 64 << 20,
+		},
+	}
+}
+
+// ListenAddr is the host:port the server binds to.
+func (c *Config) ListenAddr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// TrustedProxies returns the parsed trusted proxy prefixes.
+func (c *Config) TrustedProxies() []netip.Prefix {
+	prefixes, _ := parsePrefixes(c.RateLimit.TrustedProxies)
+	return prefixes
+}
+
+// Validate reports every problem with c at once.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(field string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Spotify.ClientID == "" {
+		fail("spotify.client_id", "missing, set SL_SPOTIFY_CLIENT_ID")
+	}
+	if c.Spotify.ClientSecret == "" {
+		fail("spotify.client_secret", "missing, set SL_SPOTIFY_CLIENT_SECRET")
+	}
+	if c.Host == "" {
+		fail("host", "must not be empty")
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		fail("port", "must be between 1 and 65535, got %d", c.Port)
+	}
+	if u, err := url.Parse(c.Addr); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fail("addr", "must be an absolute http(s) URL, got %q", c.Addr)
+	}
+	for _, origin := range c.Origins {
+		if _, err := ParseOrigin(origin); err != nil {
+			fail("origins", "%v", err)
+		}
+	}
+	if c.Cors.MaxAge < 0 {
+		fail("cors.max_age", "must not be negative")
+	}
+	for path, origins := range c.Cors.Routes {
+		if !strings.HasPrefix(path, "/") {
+			fail("cors.routes", "path must start with /, got %q", path)
+		}
+		for _, origin := range origins {
+			if _, err := ParseOrigin(origin); err != nil {
+				fail("cors.routes."+path, "%v", err)
+			}
+		}
+	}
+	for _, k := range c.Auth.Keys {
+		if err := k.Validate(); err != nil {
+			fail("auth.keys", "%v", err)
+		}
+	}
+	if _, err := parsePrefixes(c.RateLimit.TrustedProxies); err != nil {
+		fail("rate_limit.trusted_proxies", "%v", err)
+	}
+	for name, limit := range map[string]RateLimit{"read": c.RateLimit.Read, "control": c.RateLimit.Control} {
+		if limit.PerMinute <= 0 {
+			fail("rate_limit."+name+".per_minute", "must be positive, got %v", limit.PerMinute)
+		}
+		if limit.Burst < 1 {
+			fail("rate_limit."+name+".burst", "must be at least 1, got %d", limit.Burst)
+		}
+	}
+	for name, cache := range map[string]Cache{
+		"current": c.Cache.Current,
+		"queue":   c.Cache.Queue,
+		"recent":  c.Cache.Recent,
+		"top":     c.Cache.Top,
+	} {
+		if cache.Fresh < 0 || cache.Stale < 0 || cache.MinInterval < 0 {
+			fail("cache."+name, "durations must not be negative")
+		}
+	}
+	if !slices.Contains(AccessLogFormats, c.AccessLog.Format) {
+		fail("access_log.format", "must be one of %s, got %q", strings.Join(AccessLogFormats, ", "), c.AccessLog.Format)
+	}
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("tracing.endpoint", "must be an absolute http(s) URL, got %q", c.Tracing.Endpoint)
+		}
+	}
+	for path, rate := range c.AccessLog.Sample {
+		if rate < 0 || rate > 1 {
+			fail("access_log.sample", "rate for %s must be between 0 and 1, got %v", path, rate)
+		}
+	}
+	if c.Art.CacheSize < 0 {
+		fail("art.cache_size", "must not be negative, got %d", c.Art.CacheSize)
+	}
+
+	return errors.Join(errs...)
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if strings.Contains(v, "/") {
+			prefix, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid prefix %q: %w", v, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", v, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
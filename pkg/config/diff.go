@@ -0,0 +1,86 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Fields whose values must never be logged.
+var secretFields = map[string]bool{
+	"client_secret": true,
+	"key":           true,
+}
+
+// Diff describes every setting that differs between old and new, one line
+// per setting, with secrets redacted.
+func Diff(old *Config, new *Config) []string {
+	before, after := flatten(old), flatten(new)
+
+	keys := slices.Sorted(maps.Keys(before))
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	var changes []string
+	for _, k := range keys {
+		b, inBefore := before[k]
+		a, inAfter := after[k]
+		switch {
+		case !inBefore:
+			changes = append(changes, fmt.Sprintf("+ %s: %s", k, a))
+		case !inAfter:
+			changes = append(changes, fmt.Sprintf("- %s: %s", k, b))
+		case a != b:
+			changes = append(changes, fmt.Sprintf("~ %s: %s -> %s", k, b, a))
+		}
+	}
+	return changes
+}
+
+// flatten turns c into dotted paths mapped to JSON encoded leaf values.
+func flatten(c *Config) map[string]string {
+	data, _ := json.Marshal(c)
+	var tree any
+	_ = json.Unmarshal(data, &tree)
+
+	flat := map[string]string{}
+	var walk func(prefix string, field string, v any)
+	walk = func(prefix string, field string, v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, child := range v {
+				walk(join(prefix, k), k, child)
+			}
+		case []any:
+			for i, child := range v {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), field, child)
+			}
+		case nil:
+			// Empty lists and objects are the same as missing ones
+		default:
+			encoded, _ := json.Marshal(v)
+			if secretFields[field] {
+				// Keep a fingerprint so rotated secrets still show up as changed
+				sum := sha256.Sum256(encoded)
+				flat[prefix] = fmt.Sprintf(`"<redacted %x>"`, sum[:4])
+				return
+			}
+			flat[prefix] = string(encoded)
+		}
+	}
+	walk("", "", tree)
+	return flat
+}
+
+func join(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
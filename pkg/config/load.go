@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shantanuraj/listening/pkg/apikey"
+	"github.com/shantanuraj/listening/pkg/dirs"
+)
+
+// Flags are the command-line flags that override the configuration.
+type Flags struct {
+	fs         *flag.FlagSet
+	configPath *string
+	host       *string
+	port       *int
+	addr       *string
+	origins    *string
+	keysFile   *string
+	publicRead *bool
+}
+
+// AddFlags registers the configuration flags on fs. Load must only be
+// called once fs has been parsed.
+func AddFlags(fs *flag.FlagSet) *Flags {
+	return &Flags{
+		fs:         fs,
+		configPath: fs.String("config", os.Getenv("SL_CONFIG"), "path to the config file (default ~/.config/listening/config.json)"),
+		host:       fs.String("host", "", "host to listen on"),
+		port:       fs.Int("port", 0, "port to listen on"),
+		addr:       fs.String("addr", "", "address Spotify redirects to after the OAuth flow"),
+		origins:    fs.String("origins", "", "comma separated origins allowed by the CORS policy"),
+		keysFile:   fs.String("keys-file", "", "path to the API keys file"),
+		publicRead: fs.Bool("public-read", true, "allow read routes without an API key"),
+	}
+}
+
+// Load builds the configuration from, in increasing order of precedence,
+// the defaults, the config file, SL_* environment variables and the parsed
+// flags. The result is validated before it is returned.
+func Load(flags *Flags) (*Config, error) {
+	cfg := Default()
+
+	path, explicit := *flags.configPath, *flags.configPath != ""
+	if !explicit {
+		defaultPath, err := dirs.ConfigPath()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get config path: %w", err)
+		}
+		path = defaultPath
+	}
+	if err := cfg.loadFile(path, explicit); err != nil {
+		return nil, err
+	}
+	cfg.Path = path
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	flags.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			cfg.Host = *flags.host
+		case "port":
+			cfg.Port = *flags.port
+		case "addr":
+			cfg.Addr = *flags.addr
+		case "origins":
+			cfg.Origins = splitList(*flags.origins)
+		case "keys-file":
+			cfg.Auth.KeysFile = *flags.keysFile
+		case "public-read":
+			cfg.Auth.PublicRead = *flags.publicRead
+		}
+	})
+
+	if err := cfg.resolve(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the JSON config at path. A missing file is only an error
+// when the path was given explicitly.
+func (c *Config) loadFile(path string, explicit bool) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	var errs []error
+
+	setString := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	setInt := func(name string, dst *int) {
+		if v, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid integer %q", name, v))
+				return
+			}
+			*dst = parsed
+		}
+	}
+	setInt64 := func(name string, dst *int64) {
+		if v, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid integer %q", name, v))
+				return
+			}
+			*dst = parsed
+		}
+	}
+	setFloat := func(name string, dst *float64) {
+		if v, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid number %q", name, v))
+				return
+			}
+			*dst = parsed
+		}
+	}
+	setBool := func(name string, dst *bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid boolean %q", name, v))
+				return
+			}
+			*dst = parsed
+		}
+	}
+	setList := func(name string, dst *[]string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = splitList(v)
+		}
+	}
+
+	setString("SL_SPOTIFY_CLIENT_ID", &c.Spotify.ClientID)
+	setString("SL_SPOTIFY_CLIENT_SECRET", &c.Spotify.ClientSecret)
+	setString("SL_HOST", &c.Host)
+	setInt("SL_PORT", &c.Port)
+	setString("SL_ADDR", &c.Addr)
+	setList("SL_ORIGINS", &c.Origins)
+	// SL_DEV_ORIGIN and SL_PROD_ORIGIN predate SL_ORIGINS and replace the
+	// first and second default origin respectively
+	if v, ok := os.LookupEnv("SL_DEV_ORIGIN"); ok && len(c.Origins) > 0 {
+		c.Origins[0] = v
+	}
+	if v, ok := os.LookupEnv("SL_PROD_ORIGIN"); ok && len(c.Origins) > 1 {
+		c.Origins[1] = v
+	}
+	setString("SL_API_KEYS_FILE", &c.Auth.KeysFile)
+	setBool("SL_PUBLIC_READ", &c.Auth.PublicRead)
+	setBool("SL_DEVICE_LOGIN", &c.Auth.DeviceLogin)
+	setList("SL_TRUSTED_PROXIES", &c.RateLimit.TrustedProxies)
+	setFloat("SL_READ_RATE_LIMIT", &c.RateLimit.Read.PerMinute)
+	setInt("SL_READ_BURST", &c.RateLimit.Read.Burst)
+	setFloat("SL_CONTROL_RATE_LIMIT", &c.RateLimit.Control.PerMinute)
+	setInt("SL_CONTROL_BURST", &c.RateLimit.Control.Burst)
+	setString("SL_ACCESS_LOG_FORMAT", &c.AccessLog.Format)
+	setList("SL_ACCESS_LOG_EXCLUDE", &c.AccessLog.Exclude)
+	setString("SL_TRACE_FILE", &c.Tracing.File)
+	setString("SL_TRACE_ENDPOINT", &c.Tracing.Endpoint)
+	setString("SL_TRACE_SERVICE_NAME", &c.Tracing.ServiceName)
+	setInt64("SL_ART_CACHE_SIZE", &c.Art.CacheSize)
+
+	return errors.Join(errs...)
+}
+
+// resolve fills in values derived from other settings and loads the API
+// keys file.
+func (c *Config) resolve() error {
+	if c.Addr == "" {
+		c.Addr = fmt.Sprintf("http://%s:%d", c.Host, c.Port)
+	}
+
+	if c.Auth.KeysFile == "" {
+		keysPath, err := dirs.KeysPath()
+		if err != nil {
+			return fmt.Errorf("failed to get keys path: %w", err)
+		}
+		c.Auth.KeysFile = keysPath
+	}
+	keys, err := apikey.LoadFile(c.Auth.KeysFile)
+	if err != nil {
+		return fmt.Errorf("failed to load api keys: %w", err)
+	}
+	c.Auth.Keys = append(c.Auth.Keys, keys...)
+
+	return nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
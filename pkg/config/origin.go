@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// OriginPattern matches the Origin header of cross-origin requests. It is
+// either an exact origin, an origin whose host starts with a "*." wildcard
+// matching any subdomain, or "*" matching every origin.
+type OriginPattern struct {
+	Any      bool
+	Wildcard bool
+	Scheme   string
+	Host     string // Without the wildcard label
+	Port     string
+}
+
+func ParseOrigin(s string) (OriginPattern, error) {
+	if s == "*" {
+		return OriginPattern{Any: true}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return OriginPattern{}, fmt.Errorf("must be scheme://host[:port] or *, got %q", s)
+	}
+
+	p := OriginPattern{
+		Scheme: strings.ToLower(u.Scheme),
+		Host:   strings.ToLower(u.Hostname()),
+		Port:   u.Port(),
+	}
+	if host, ok := strings.CutPrefix(p.Host, "*."); ok {
+		p.Wildcard, p.Host = true, host
+	}
+	if p.Host == "" || strings.Contains(p.Host, "*") {
+		return OriginPattern{}, fmt.Errorf("wildcards are only allowed as the first label of the host, got %q", s)
+	}
+	return p, nil
+}
+
+// ParseOrigins parses every pattern in origins.
+func ParseOrigins(origins []string) ([]OriginPattern, error) {
+	patterns := make([]OriginPattern, 0, len(origins))
+	for _, origin := range origins {
+		p, err := ParseOrigin(origin)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// Match reports whether origin is allowed by p. A wildcard only matches
+// subdomains, not the host itself.
+func (p OriginPattern) Match(origin string) bool {
+	if origin == "" || origin == "null" {
+		return false
+	}
+	if p.Any {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Scheme, p.Scheme) || u.Port() != p.Port {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if p.Wildcard {
+		return strings.HasSuffix(host, "."+p.Host)
+	}
+	return host == p.Host
+}
@@ -0,0 +1,58 @@
+package config
+
+import "testing"
+
+func TestOriginPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"*", "https://example.com", true},
+		{"*", "null", false},
+		{"*", "", false},
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://EXAMPLE.com", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://example.com", "https://example.com:8443", false},
+		{"https://example.com", "https://example.com.evil.com", false},
+		{"https://example.com", "https://sub.example.com", false},
+		{"http://localhost:4321", "http://localhost:4321", true},
+		{"http://localhost:4321", "http://localhost:4322", false},
+		{"http://localhost:4321", "http://localhost", false},
+		{"https://*.example.com", "https://a.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "http://a.example.com", false},
+		{"https://*.example.com:8443", "https://a.example.com:8443", true},
+		{"https://*.example.com:8443", "https://a.example.com", false},
+	}
+	for _, tt := range tests {
+		p, err := ParseOrigin(tt.pattern)
+		if err != nil {
+			t.Fatalf("ParseOrigin(%q): %v", tt.pattern, err)
+		}
+		if got := p.Match(tt.origin); got != tt.want {
+			t.Errorf("%q.Match(%q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestParseOriginInvalid(t *testing.T) {
+	for _, origin := range []string{
+		"",
+		"example.com",
+		"https://example.com/",
+		"https://example.com/path",
+		"https://user@example.com",
+		"https://example.com?q=1",
+		"https://*",
+		"https://a.*.example.com",
+		"https://*example.com",
+	} {
+		if _, err := ParseOrigin(origin); err == nil {
+			t.Errorf("ParseOrigin(%q) succeeded, want an error", origin)
+		}
+	}
+}
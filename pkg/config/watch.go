@@ -0,0 +1,52 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+func stat(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size(), exists: true}
+}
+
+// Watch polls paths every interval and calls onChange when any of them is
+// created, removed or modified. It returns when ctx is done.
+func Watch(ctx context.Context, interval time.Duration, paths []string, onChange func()) {
+	states := make([]fileState, len(paths))
+	for i, path := range paths {
+		states[i] = stat(path)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed := false
+		for i, path := range paths {
+			if state := stat(path); state != states[i] {
+				states[i] = state
+				changed = true
+			}
+		}
+		if changed {
+			onChange()
+		}
+	}
+}
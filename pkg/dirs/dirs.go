@@ -29,3 +29,35 @@ func CredentialsPath() (string, error) {
 
 	return path.Join(cacheDir, "credentials.json"), nil
 }
+
+func ConfigDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	configDir := path.Join(homeDir, ".config", APP_NAME)
+	if _, err := os.Stat(configDir); os.IsNotExist(err) {
+		os.MkdirAll(configDir, 0755)
+	}
+
+	return configDir, nil
+}
+
+func KeysPath() (string, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(configDir, "keys.json"), nil
+}
+
+func ConfigPath() (string, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(configDir, "config.json"), nil
+}
@@ -0,0 +1,194 @@
+package diskcache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores values as files in a directory, evicting the least recently
+// used once their total size is over budget. Reads bump the modification
+// time of a file, so the order of use survives restarts.
+type Cache struct {
+	dir string
+
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List // Most recently used first
+	entries  map[string]*list.Element
+}
+
+type entry struct {
+	key  string
+	size int64
+}
+
+// Open indexes the files already in dir, creating it if needed, and evicts
+// any over maxBytes.
+func Open(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var found []file
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		// Left behind by a write that did not finish
+		if strings.HasPrefix(f.Name(), ".") {
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, file{f.Name(), info.Size(), info.ModTime()})
+	}
+	slices.SortFunc(found, func(a, b file) int {
+		return b.modTime.Compare(a.modTime)
+	})
+
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+	for _, f := range found {
+		c.entries[f.name] = c.order.PushBack(&entry{key: f.name, size: f.size})
+		c.size += f.size
+	}
+	c.evictLocked()
+	return c, nil
+}
+
+// Get returns the value stored under key.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	if !validKey(key) {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	path := filepath.Join(c.dir, key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.removeLocked(el)
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	c.order.MoveToFront(el)
+	return data, true
+}
+
+// Put stores data under key, replacing any previous value, and evicts the
+// least recently used values over budget.
+func (c *Cache) Put(key string, data []byte) error {
+	if !validKey(key) {
+		return fmt.Errorf("diskcache: invalid key %q", key)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.size -= el.Value.(*entry).size
+		c.order.Remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, size: int64(len(data))})
+	c.size += int64(len(data))
+	c.evictLocked()
+	return nil
+}
+
+// SetMaxBytes changes the budget, evicting right away if it shrank.
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	c.evictLocked()
+}
+
+// Purge deletes every stored value.
+func (c *Cache) Purge() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for c.order.Len() > 0 {
+		el := c.order.Back()
+		if err := c.removeLocked(el); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Cache) evictLocked() {
+	for c.size > c.maxBytes && c.order.Len() > 0 {
+		c.removeLocked(c.order.Back())
+	}
+}
+
+func (c *Cache) removeLocked(el *list.Element) error {
+	e := el.Value.(*entry)
+	c.order.Remove(el)
+	delete(c.entries, e.key)
+	c.size -= e.size
+
+	err := os.Remove(filepath.Join(c.dir, e.key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// validKey reports whether key can be used as a file name in the cache
+// directory without escaping it or clashing with temporary files.
+func validKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, ".") && !strings.ContainsAny(key, `/\`)
+}
@@ -0,0 +1,128 @@
+package imagecache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Image is a downloaded image.
+type Image struct {
+	Data        []byte
+	ContentType string
+}
+
+// Cache is an in-memory LRU cache of images keyed by URL, bounded by the
+// total size of the images it holds.
+type Cache struct {
+	httpClient *http.Client
+	maxBytes   int64
+	maxImage   int64
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List // Most recently used first
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	url   string
+	image Image
+}
+
+// New returns a cache holding up to maxBytes of images, refusing any single
+// image larger than maxImage.
+func New(maxBytes int64, maxImage int64) *Cache {
+	return &Cache{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		maxBytes:   maxBytes,
+		maxImage:   maxImage,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the image at url, downloading it when it is not cached.
+func (c *Cache) Get(ctx context.Context, url string) (Image, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[url]; ok {
+		c.order.MoveToFront(el)
+		image := el.Value.(*entry).image
+		c.mu.Unlock()
+		return image, nil
+	}
+	c.mu.Unlock()
+
+	image, err := c.Fetch(ctx, url)
+	if err != nil {
+		return Image{}, err
+	}
+	c.add(url, image)
+	return image, nil
+}
+
+// Fetch downloads the image at url without caching it.
+func (c *Cache) Fetch(ctx context.Context, url string) (Image, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return Image{}, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Image{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Image{}, fmt.Errorf("image: unexpected status code: %d", resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		return Image{}, fmt.Errorf("image: unexpected content type: %q", contentType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.maxImage+1))
+	if err != nil {
+		return Image{}, err
+	}
+	if int64(len(data)) > c.maxImage {
+		return Image{}, fmt.Errorf("image: larger than %d bytes", c.maxImage)
+	}
+
+	return Image{Data: data, ContentType: contentType}, nil
+}
+
+func (c *Cache) add(url string, image Image) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[url]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[url] = c.order.PushFront(&entry{url: url, image: image})
+	c.size += int64(len(image.Data))
+
+	for c.size > c.maxBytes && c.order.Len() > 1 {
+		oldest := c.order.Back()
+		e := oldest.Value.(*entry)
+		c.order.Remove(oldest)
+		delete(c.entries, e.url)
+		c.size -= int64(len(e.image.Data))
+	}
+}
+
+// Purge drops every cached image.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.entries)
+	c.size = 0
+}
@@ -0,0 +1,150 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[41m"
+	colorGreen  = "\033[42m"
+	colorYellow = "\033[43m"
+	colorBlue   = "\033[44m"
+	colorFaint  = "\033[2m"
+)
+
+// colorHandler writes human readable records for a terminal, colouring the
+// level and any HTTP status.
+type colorHandler struct {
+	opts   *slog.HandlerOptions
+	attrs  []byte // Preformatted attributes from WithAttrs
+	prefix string // Group prefix from WithGroup
+
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func newColorHandler(w io.Writer, opts *slog.HandlerOptions) *colorHandler {
+	return &colorHandler{opts: opts, mu: &sync.Mutex{}, w: w}
+}
+
+func (h *colorHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *colorHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	buf.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	buf.WriteString(colorizeLevel(r.Level))
+	buf.WriteByte(' ')
+	buf.WriteString(r.Message)
+	buf.Write(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&buf, h.prefix, a)
+		return true
+	})
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *colorHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var buf bytes.Buffer
+	buf.Write(h.attrs)
+	for _, a := range attrs {
+		appendAttr(&buf, h.prefix, a)
+	}
+	clone := *h
+	clone.attrs = buf.Bytes()
+	return &clone
+}
+
+func (h *colorHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+func appendAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			appendAttr(buf, prefix, ga)
+		}
+		return
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(colorFaint + prefix + a.Key + "=" + colorReset)
+	switch {
+	case a.Key == "status" && a.Value.Kind() == slog.KindInt64:
+		buf.WriteString(colorizeStatus(int(a.Value.Int64())))
+	case a.Value.Kind() == slog.KindString:
+		buf.WriteString(quoteIfNeeded(a.Value.String()))
+	case a.Value.Kind() == slog.KindDuration:
+		buf.WriteString(a.Value.Duration().Round(time.Microsecond).String())
+	default:
+		buf.WriteString(quoteIfNeeded(a.Value.String()))
+	}
+}
+
+func quoteIfNeeded(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '"' || r == '=' || !strconv.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+func colorizeLevel(level slog.Level) string {
+	label := fmt.Sprintf(" %-5s ", level.String())
+	switch {
+	case level >= slog.LevelError:
+		return colorRed + label + colorReset
+	case level >= slog.LevelWarn:
+		return colorYellow + label + colorReset
+	case level >= slog.LevelInfo:
+		return colorBlue + label + colorReset
+	default:
+		return colorFaint + label + colorReset
+	}
+}
+
+func colorizeStatus(status int) string {
+	code := fmt.Sprintf(" %d ", status)
+	switch {
+	case status >= 500:
+		return colorRed + code + colorReset
+	case status >= 400:
+		return colorYellow + code + colorReset
+	default:
+		return colorGreen + code + colorReset
+	}
+}
@@ -1,73 +1,194 @@
 package log
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
 	"time"
-)
 
-const (
-	colorReset  = "\033[0m"
-	colorRed    = "\033[41m"
-	colorGreen  = "\033[42m"
-	colorYellow = "\033[43m"
+	"github.com/shantanuraj/listening/pkg/requestid"
 )
 
+// Logger writes leveled, structured log records through log/slog. Errors go
+// to their own writer so they can be told apart from regular output.
 type Logger struct {
-	logger *log.Logger
-	debug  *log.Logger
-	info   *log.Logger
-	warn   *log.Logger
-	error  *log.Logger
+	out *slog.Logger
+	err *slog.Logger
+}
+
+// Options select how records are written.
+type Options struct {
+	Level  slog.Level
+	Format string // "text" or "json"
+	Color  bool   // Colour the level and status of text records
 }
 
 var defaultLogger = New()
 
+// New returns a Logger writing to stdout and errors to stderr, configured
+// from SL_LOG_LEVEL and SL_LOG_FORMAT. Text output to each of them is
+// coloured only when it is a terminal and NO_COLOR is unset, so redirecting
+// one to a file keeps escape codes out of it.
 func New() *Logger {
+	opts := optionsFromEnv()
+	errOpts := opts
+	opts.Color, errOpts.Color = useColor(os.Stdout), useColor(os.Stderr)
 	return &Logger{
-		logger: log.New(os.Stdout, "", log.LstdFlags),
-		debug:  log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile),
-		info:   log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime),
-		warn:   log.New(os.Stdout, "WARN: ", log.Ldate|log.Ltime),
-		error:  log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile),
+		out: slog.New(newHandler(os.Stdout, opts)),
+		err: slog.New(newHandler(os.Stderr, errOpts)),
 	}
 }
 
-func (l *Logger) colorizeStatus(status int) string {
-	code := fmt.Sprintf(" %d ", status)
+// NewWriter returns a Logger that writes every level to w.
+func NewWriter(w io.Writer) *Logger {
+	opts := optionsFromEnv()
+	opts.Color = useColor(w)
+	return NewWithOptions(w, w, opts)
+}
+
+func NewWithOptions(out io.Writer, errOut io.Writer, opts Options) *Logger {
+	return &Logger{
+		out: slog.New(newHandler(out, opts)),
+		err: slog.New(newHandler(errOut, opts)),
+	}
+}
+
+func newHandler(w io.Writer, opts Options) slog.Handler {
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
 	switch {
-	case status >= 500:
-		return fmt.Sprintf("%s%s%s", colorRed, code, colorReset)
-	case status >= 400:
-		return fmt.Sprintf("%s%s%s", colorYellow, code, colorReset)
+	case opts.Format == "json":
+		return slog.NewJSONHandler(w, handlerOpts)
+	case opts.Color:
+		return newColorHandler(w, handlerOpts)
 	default:
-		return fmt.Sprintf("%s%s%s", colorGreen, code, colorReset)
+		return slog.NewTextHandler(w, handlerOpts)
+	}
+}
+
+func optionsFromEnv() Options {
+	opts := Options{Format: "text"}
+
+	if level, ok := os.LookupEnv("SL_LOG_LEVEL"); ok {
+		if err := opts.Level.UnmarshalText([]byte(level)); err != nil {
+			fmt.Fprintf(os.Stderr, "log: invalid SL_LOG_LEVEL %q, using info\n", level)
+		}
+	}
+	if format, ok := os.LookupEnv("SL_LOG_FORMAT"); ok {
+		switch format = strings.ToLower(format); format {
+		case "text", "json":
+			opts.Format = format
+		default:
+			fmt.Fprintf(os.Stderr, "log: invalid SL_LOG_FORMAT %q, using text\n", format)
+		}
+	}
+	return opts
+}
+
+func useColor(w io.Writer) bool {
+	_, noColor := os.LookupEnv("NO_COLOR")
+	return !noColor && isTerminal(w)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// SetDefault replaces the logger used by the package level functions.
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+// With returns a Logger that adds the key-value pairs in args to every record.
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{
+		out: l.out.With(args...),
+		err: l.err.With(args...),
+	}
+}
+
+// WithContext returns a Logger that tags every record with the request ID in
+// ctx, or l itself when ctx has none.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	id := requestid.FromContext(ctx)
+	if id == "" {
+		return l
+	}
+	return l.With("request_id", id)
+}
+
+func (l *Logger) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	logger := l.out
+	if level >= slog.LevelError {
+		logger = l.err
+	}
+	logger.Log(ctx, level, msg, args...)
+}
+
+func (l *Logger) logf(level slog.Level, format string, args ...any) {
+	ctx := context.Background()
+	if !l.out.Enabled(ctx, level) {
+		return
 	}
+	l.log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Debug(msg string, args ...any) {
+	l.log(context.Background(), slog.LevelDebug, msg, args...)
+}
+
+func (l *Logger) Info(msg string, args ...any) {
+	l.log(context.Background(), slog.LevelInfo, msg, args...)
+}
+
+func (l *Logger) Warn(msg string, args ...any) {
+	l.log(context.Background(), slog.LevelWarn, msg, args...)
+}
+
+func (l *Logger) Error(msg string, args ...any) {
+	l.log(context.Background(), slog.LevelError, msg, args...)
 }
 
 func (l *Logger) Debugf(format string, args ...any) {
-	l.debug.Printf(format, args...)
+	l.logf(slog.LevelDebug, format, args...)
 }
 
 func (l *Logger) Infof(format string, args ...any) {
-	l.info.Printf(format, args...)
+	l.logf(slog.LevelInfo, format, args...)
 }
 
 func (l *Logger) Warnf(format string, args ...any) {
-	l.warn.Printf(format, args...)
+	l.logf(slog.LevelWarn, format, args...)
 }
 
 func (l *Logger) Errorf(format string, args ...any) {
-	l.error.Printf(format, args...)
+	l.logf(slog.LevelError, format, args...)
 }
 
 func (l *Logger) Fatalf(format string, args ...any) {
-	l.error.Fatalf(format, args...)
+	l.logf(slog.LevelError, format, args...)
+	os.Exit(1)
 }
 
 func (l *Logger) LogRequest(method, path string, status int, duration time.Duration) {
-	l.Infof("%s %s %s %v", l.colorizeStatus(status), method, path, duration)
+	l.Info("request",
+		"method", method,
+		"path", path,
+		"status", status,
+		"duration_ms", float64(duration.Microseconds())/1000,
+	)
+}
+
+// WithContext returns the default logger tagged with the request ID in ctx.
+func WithContext(ctx context.Context) *Logger {
+	return defaultLogger.WithContext(ctx)
 }
 
 func Debugf(format string, args ...any) {
@@ -0,0 +1,314 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram buckets in seconds suited to HTTP latencies.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds metrics and writes them in the Prometheus text exposition
+// format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.metrics {
+		if existing.name() == m.name() {
+			panic(fmt.Sprintf("metrics: %s registered twice", m.name()))
+		}
+	}
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes every metric in r, sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	slices.SortFunc(metrics, func(a, b metric) int {
+		return strings.Compare(a.name(), b.name())
+	})
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves r for Prometheus to scrape.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		r.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// desc is what every metric shares: its name, help text and label names.
+type desc struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (d desc) name() string {
+	return d.metricName
+}
+
+func (d desc) writeHeader(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.metricName, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.metricName, kind)
+}
+
+// key joins label values into a map key.
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// formatLabels renders label pairs, appending extra pre-rendered pairs.
+func (d desc) formatLabels(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra))
+	for i, v := range values {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, d.labels[i], escapeLabel(v)))
+	}
+	pairs = append(pairs, extra...)
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type series struct {
+	labels []string
+	value  float64
+}
+
+// vec is a set of float series keyed by label values.
+type vec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func (v *vec) add(delta float64, values []string) {
+	key := v.key(values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: slices.Clone(values)}
+		v.series[key] = s
+	}
+	s.value += delta
+}
+
+func (v *vec) set(value float64, values []string) {
+	key := v.key(values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: slices.Clone(values)}
+		v.series[key] = s
+	}
+	s.value = value
+}
+
+func (v *vec) writeSeries(w *bufio.Writer, kind string) {
+	v.writeHeader(w, kind)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range sortedKeys(v.series) {
+		s := v.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", v.metricName, v.formatLabels(s.labels), formatFloat(s.value))
+	}
+}
+
+// Counter is a monotonically increasing value per label set.
+type Counter struct {
+	vec
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{vec{desc: desc{name, help, labels}, series: map[string]*series{}}}
+	Default.register(c)
+	return c
+}
+
+func (c *Counter) Inc(labels ...string) {
+	c.add(1, labels)
+}
+
+func (c *Counter) Add(delta float64, labels ...string) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.add(delta, labels)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.writeSeries(w, "counter")
+}
+
+// Gauge is a value per label set that can go up and down.
+type Gauge struct {
+	vec
+}
+
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{vec{desc: desc{name, help, labels}, series: map[string]*series{}}}
+	Default.register(g)
+	return g
+}
+
+func (g *Gauge) Set(value float64, labels ...string) {
+	g.set(value, labels)
+}
+
+func (g *Gauge) Inc(labels ...string) {
+	g.add(1, labels)
+}
+
+func (g *Gauge) Dec(labels ...string) {
+	g.add(-1, labels)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.writeSeries(w, "gauge")
+}
+
+// Histogram counts observations into cumulative buckets per label set.
+type Histogram struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name, help, labels},
+		buckets: slices.Sorted(slices.Values(buckets)),
+		series:  map[string]*histogramSeries{},
+	}
+	Default.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labels ...string) {
+	key := h.key(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labels: slices.Clone(labels), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.writeHeader(w, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			le := fmt.Sprintf(`le="%s"`, formatFloat(upper))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.formatLabels(s.labels, le), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.formatLabels(s.labels, `le="+Inf"`), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.formatLabels(s.labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.formatLabels(s.labels), s.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/shantanuraj/listening/pkg/apikey"
+)
+
+// WithAPIKey requires a bearer API key granting scope. When public is set,
+// requests without an Authorization header are let through anonymously, but
+// a key that is present must still be valid.
+//
+// Missing and invalid keys take a token from the client IP's bucket in
+// failures, and clients that have emptied it are answered with 429 before
+// their key is looked at, so keys cannot be guessed at any speed.
+func WithAPIKey(keys *apikey.Store, scope apikey.Scope, public bool, failures *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" && public {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			failureKey := "auth-failure:" + failures.key(r)
+			if ok, retryAfter := failures.Peek(failureKey); !ok {
+				tooManyRequests(w, retryAfter)
+				return
+			}
+			unauthorized := func(challenge string, msg string) {
+				failures.Allow(failureKey)
+				w.Header().Set("WWW-Authenticate", challenge)
+				http.Error(w, msg, http.StatusUnauthorized)
+			}
+
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || token == "" {
+				unauthorized(`Bearer realm="listening"`, "missing api key")
+				return
+			}
+
+			key, ok := keys.Lookup(token)
+			if !ok {
+				unauthorized(`Bearer realm="listening", error="invalid_token"`, "invalid api key")
+				return
+			}
+			if !key.Allows(scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="listening", error="insufficient_scope"`)
+				http.Error(w, "insufficient api key scope", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(apikey.WithKey(r.Context(), key)))
+		})
+	}
+}
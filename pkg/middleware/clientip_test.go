@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		trusted      []netip.Prefix
+		want         string
+	}{
+		{"direct", "203.0.113.7:1234", nil, trusted, "203.0.113.7"},
+		{"untrusted remote ignores header", "203.0.113.7:1234", []string{"198.51.100.1"}, trusted, "203.0.113.7"},
+		{"no trusted proxies ignores header", "10.0.0.1:1234", []string{"198.51.100.1"}, nil, "10.0.0.1"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"198.51.100.1"}, trusted, "198.51.100.1"},
+		{"right-most untrusted hop", "10.0.0.1:1234", []string{"192.0.2.9, 198.51.100.1, 10.0.0.2"}, trusted, "198.51.100.1"},
+		{"spoofed left-most hop", "10.0.0.1:1234", []string{"1.2.3.4", "198.51.100.1"}, trusted, "198.51.100.1"},
+		{"every hop trusted", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, trusted, "10.0.0.3"},
+		{"invalid hop stops the walk", "10.0.0.1:1234", []string{"198.51.100.1, garbage, 10.0.0.2"}, trusted, "10.0.0.2"},
+		{"mapped IPv4", "[::ffff:10.0.0.1]:1234", []string{"::ffff:198.51.100.1"}, trusted, "198.51.100.1"},
+		{"IPv6", "[fd00::1]:1234", []string{"2001:db8::1"}, trusted, "2001:db8::1"},
+		{"no port", "203.0.113.7", nil, trusted, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(r, tt.trusted); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
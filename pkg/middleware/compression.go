@@ -0,0 +1,261 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Bodies smaller than this are not worth the compression overhead.
+const minCompressSize = 1024
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+var (
+	gzipPool = sync.Pool{New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}}
+	zlibPool = sync.Pool{New: func() any {
+		return zlib.NewWriter(io.Discard)
+	}}
+)
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// WithCompression compresses responses with gzip or deflate as negotiated by
+// the Accept-Encoding request header. Small bodies, event streams and content
+// that is not text-like are passed through untouched.
+func WithCompression() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				status:         http.StatusOK,
+			}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks the supported encoding with the highest quality
+// value, preferring gzip on ties. It returns "" when neither is acceptable.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{encodingGzip, encodingDeflate} {
+		q, ok := qualities[encoding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// compressWriter buffers the start of a response until it knows whether the
+// body is large enough to compress, then commits to either compressing or
+// passing the response through.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	compressor  compressor
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+	cw.wroteHeader = true
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) >= minCompressSize {
+			if err := cw.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if cw.compressor != nil {
+		return cw.compressor.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if cw.compressor != nil {
+		cw.compressor.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over to the handler, which is only possible
+// before anything of the response has been written.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if cw.wroteHeader {
+		return nil, nil, errors.New("hijack: response already started")
+	}
+	h, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijack: %T does not support hijacking", cw.ResponseWriter)
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		// Nothing may be written through cw once the connection is gone
+		cw.decided = true
+	}
+	return conn, rw, err
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide commits the response headers, compressing the body if compress is
+// set and the content allows it, and writes out anything buffered so far.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+
+	h := cw.Header()
+	if compress && h.Get("Content-Encoding") == "" && isCompressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		// The compressed representation is no longer byte-identical
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.compressor = acquireCompressor(cw.encoding, cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.compressor != nil {
+		_, err := cw.compressor.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided && cw.wroteHeader {
+		cw.decide(false)
+	}
+	if cw.compressor != nil {
+		cw.compressor.Close()
+		releaseCompressor(cw.encoding, cw.compressor)
+		cw.compressor = nil
+	}
+}
+
+func acquireCompressor(encoding string, w io.Writer) compressor {
+	var c compressor
+	if encoding == encodingGzip {
+		c = gzipPool.Get().(*gzip.Writer)
+	} else {
+		c = zlibPool.Get().(*zlib.Writer)
+	}
+	c.Reset(w)
+	return c
+}
+
+func releaseCompressor(encoding string, c compressor) {
+	c.Reset(io.Discard)
+	if encoding == encodingGzip {
+		gzipPool.Put(c)
+	} else {
+		zlibPool.Put(c)
+	}
+}
@@ -1,29 +1,173 @@
 package middleware
 
-import "net/http"
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
-func WithCors(enabledOrigins []string) func(http.Handler) http.Handler {
-	originsMap := make(map[string]struct{}, len(enabledOrigins))
-	for _, o := range enabledOrigins {
-		originsMap[o] = struct{}{}
+	"github.com/shantanuraj/listening/pkg/config"
+)
+
+// corsMethods are the methods checked against the routes to answer
+// preflight requests.
+var corsMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// Cors is the CORS policy. The allowed methods for a path are those of the
+// routes registered on mux, the rest can be replaced while the server is
+// running.
+type Cors struct {
+	mux    *http.ServeMux
+	policy atomic.Pointer[corsPolicy]
+}
+
+type corsPolicy struct {
+	origins       []config.OriginPattern
+	routes        []corsRoute // Longest path first
+	maxAge        string
+	allowHeaders  string
+	exposeHeaders string
+}
+
+type corsRoute struct {
+	path    string
+	origins []config.OriginPattern
+}
+
+func NewCors(mux *http.ServeMux, origins []string, cfg config.Cors) *Cors {
+	c := &Cors{mux: mux}
+	c.Replace(origins, cfg)
+	return c
+}
+
+// Replace swaps in new allowed origins and CORS settings. Origins that do
+// not parse are skipped, config.Validate reports them.
+func (c *Cors) Replace(origins []string, cfg config.Cors) {
+	p := &corsPolicy{
+		origins:       parseOrigins(origins),
+		maxAge:        strconv.Itoa(int(time.Duration(cfg.MaxAge).Seconds())),
+		allowHeaders:  strings.Join(cfg.AllowHeaders, ", "),
+		exposeHeaders: strings.Join(cfg.ExposeHeaders, ", "),
+	}
+	for path, routeOrigins := range cfg.Routes {
+		p.routes = append(p.routes, corsRoute{path: path, origins: parseOrigins(routeOrigins)})
+	}
+	slices.SortFunc(p.routes, func(a, b corsRoute) int {
+		return len(b.path) - len(a.path)
+	})
+	c.policy.Store(p)
+}
+
+func parseOrigins(origins []string) []config.OriginPattern {
+	patterns := make([]config.OriginPattern, 0, len(origins))
+	for _, origin := range origins {
+		if p, err := config.ParseOrigin(origin); err == nil {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// Allowed reports whether origin may make cross-origin requests to path.
+func (c *Cors) Allowed(origin string, path string) bool {
+	return c.policy.Load().allowed(origin, path)
+}
+
+func (p *corsPolicy) allowed(origin string, path string) bool {
+	_, ok := p.allowOrigin(origin, path)
+	return ok
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin on
+// path: "*" when every origin is allowed, so browsers never treat it as
+// trusted with credentials, and the origin itself otherwise.
+func (p *corsPolicy) allowOrigin(origin string, path string) (string, bool) {
+	patterns := p.origins
+	for _, route := range p.routes {
+		if matchPath(route.path, path) {
+			patterns = route.origins
+			break
+		}
+	}
+	i := slices.IndexFunc(patterns, func(pattern config.OriginPattern) bool {
+		return pattern.Match(origin)
+	})
+	switch {
+	case i < 0:
+		return "", false
+	case patterns[i].Any:
+		return "*", true
+	default:
+		return origin, true
+	}
+}
+
+// Methods returns the methods routed for the path of r.
+func (c *Cors) Methods(r *http.Request) []string {
+	var methods []string
+	for _, method := range corsMethods {
+		probe := &http.Request{Method: method, URL: r.URL, Host: r.Host, Header: http.Header{}}
+		if _, pattern := c.mux.Handler(probe); pattern != "" {
+			methods = append(methods, method)
+		}
 	}
+	return methods
+}
 
+// WithCors applies c to cross-origin requests. Preflight requests are
+// answered here: from unknown origins with 403, and for methods that have no
+// route with 405. Responses to allowed origins expose the configured headers.
+// Credentials are never allowed, since API keys are sent as a header rather
+// than a cookie.
+func WithCors(c *Cors) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
 			origin := r.Header.Get("Origin")
-			if _, ok := originsMap[origin]; ok {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-				w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
 			}
 
-			// Handle preflight requests
-			if r.Method == http.MethodOptions {
-				w.WriteHeader(http.StatusOK)
+			p := c.policy.Load()
+			allowOrigin, allowed := p.allowOrigin(origin, r.URL.Path)
+			requestMethod := r.Header.Get("Access-Control-Request-Method")
+
+			if r.Method == http.MethodOptions && requestMethod != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				if !allowed {
+					http.Error(w, "cors: origin not allowed", http.StatusForbidden)
+					return
+				}
+				methods := c.Methods(r)
+				if !slices.Contains(methods, requestMethod) {
+					h.Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+					http.Error(w, "cors: method not allowed", http.StatusMethodNotAllowed)
+					return
+				}
+
+				h.Set("Access-Control-Allow-Origin", allowOrigin)
+				h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+				if p.allowHeaders != "" {
+					h.Set("Access-Control-Allow-Headers", p.allowHeaders)
+				}
+				h.Set("Access-Control-Max-Age", p.maxAge)
+				w.WriteHeader(http.StatusNoContent)
 				return
 			}
 
+			if allowed {
+				h.Set("Access-Control-Allow-Origin", allowOrigin)
+				if p.exposeHeaders != "" {
+					h.Set("Access-Control-Expose-Headers", p.exposeHeaders)
+				}
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -1,26 +1,238 @@
 package middleware
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/shantanuraj/listening/pkg/config"
 	"github.com/shantanuraj/listening/pkg/log"
+	"github.com/shantanuraj/listening/pkg/requestid"
 )
 
+// responseWriter records the status and size of a response. It passes
+// flushes and hijacks through so streaming routes keep working.
 type responseWriter struct {
 	http.ResponseWriter
-	status int
+	status      int
+	bytes       int64
+	wroteHeader bool
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
-	rw.status = code
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = code >= 200
+	}
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-func WithLogging(log *log.Logger) func(http.Handler) http.Handler {
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+func (rw *responseWriter) Flush() {
+	rw.wroteHeader = true
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijack: %T does not support hijacking", rw.ResponseWriter)
+	}
+	rw.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// AccessLog decides which requests are logged and how they are written.
+type AccessLog struct {
+	log *log.Logger
+	w   io.Writer // Destination of the common, combined and json formats
+
+	mu      sync.Mutex
+	cfg     config.AccessLog
+	trusted []netip.Prefix
+}
+
+func NewAccessLog(log *log.Logger, w io.Writer, cfg config.AccessLog, trusted []netip.Prefix) *AccessLog {
+	return &AccessLog{log: log, w: w, cfg: cfg, trusted: trusted}
+}
+
+// SetConfig changes the format, exclusions and sampling of the access log.
+func (a *AccessLog) SetConfig(cfg config.AccessLog) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cfg = cfg
+}
+
+// SetTrustedProxies changes which proxies' X-Forwarded-For is honoured when
+// logging the client IP.
+func (a *AccessLog) SetTrustedProxies(trusted []netip.Prefix) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.trusted = trusted
+}
+
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	ClientIP   string    `json:"client_ip"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Referer    string    `json:"referer,omitempty"`
+}
+
+func (a *AccessLog) record(r *http.Request, rw *responseWriter, start time.Time) {
+	a.mu.Lock()
+	cfg, trusted := a.cfg, a.trusted
+	a.mu.Unlock()
+
+	if !shouldLog(cfg, r.URL.Path, rw.status) {
+		return
+	}
+
+	e := accessEntry{
+		Time:       start,
+		RequestID:  requestid.FromContext(r.Context()),
+		ClientIP:   ClientIP(r, trusted),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Proto:      r.Proto,
+		Status:     rw.status,
+		Bytes:      rw.bytes,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		UserAgent:  r.UserAgent(),
+		Referer:    r.Referer(),
+	}
+
+	switch cfg.Format {
+	case "common", "combined":
+		a.write([]byte(formatCommon(e, cfg.Format == "combined")))
+	case "json":
+		line, _ := json.Marshal(e)
+		a.write(append(line, '\n'))
+	default:
+		a.log.WithContext(r.Context()).With(
+			"query", e.Query,
+			"bytes", e.Bytes,
+			"client_ip", e.ClientIP,
+			"user_agent", e.UserAgent,
+			"referer", e.Referer,
+		).LogRequest(e.Method, e.Path, e.Status, time.Since(start))
+	}
+}
+
+func (a *AccessLog) write(line []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(line); err != nil {
+		a.log.Errorf("access log: failed to write: %v", err)
+	}
+}
+
+// shouldLog applies the exclusions and sampling in cfg to path. Server
+// errors are always logged.
+func shouldLog(cfg config.AccessLog, path string, status int) bool {
+	for _, excluded := range cfg.Exclude {
+		if matchPath(excluded, path) {
+			return false
+		}
+	}
+	if status >= 500 {
+		return true
+	}
+
+	rate, longest := 1.0, -1
+	for prefix, r := range cfg.Sample {
+		if matchPath(prefix, path) && len(prefix) > longest {
+			rate, longest = r, len(prefix)
+		}
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// matchPath reports whether path is pattern, or is below it when pattern ends
+// in a slash.
+func matchPath(pattern string, path string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(path, pattern)
+	}
+	return path == pattern
+}
+
+// formatCommon writes e in the Common Log Format, or the Combined Log Format
+// with the referer and user agent appended.
+func formatCommon(e accessEntry, combined bool) string {
+	target := e.Path
+	if e.Query != "" {
+		target += "?" + e.Query
+	}
+	size := "-"
+	if e.Bytes > 0 {
+		size = fmt.Sprint(e.Bytes)
+	}
+
+	line := fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s`,
+		e.ClientIP,
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method,
+		escapeQuoted(target),
+		e.Proto,
+		e.Status,
+		size,
+	)
+	if combined {
+		line += fmt.Sprintf(` "%s" "%s"`, dashIfEmpty(escapeQuoted(e.Referer)), dashIfEmpty(escapeQuoted(e.UserAgent)))
+	}
+	return line + "\n"
+}
+
+var quotedEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+func escapeQuoted(s string) string {
+	return quotedEscaper.Replace(s)
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// WithLogging writes an access log entry for each request through a, and
+// records request metrics for every request, logged or not.
+func WithLogging(a *AccessLog) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
+			httpInFlight.Inc()
+			defer httpInFlight.Dec()
 
 			rw := &responseWriter{
 				ResponseWriter: w,
@@ -29,8 +241,8 @@ func WithLogging(log *log.Logger) func(http.Handler) http.Handler {
 
 			next.ServeHTTP(rw, r)
 
-			duration := time.Since(start)
-			log.LogRequest(r.Method, r.URL.Path, rw.status, duration)
+			a.record(r, rw, start)
+			observeRequest(r, rw.status, time.Since(start))
 		})
 	}
 }
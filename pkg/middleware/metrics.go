@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter("listening_http_requests_total", "HTTP requests by route, method and status code.", "route", "method", "status")
+	httpDuration = metrics.NewHistogram("listening_http_request_duration_seconds", "HTTP request latency by route.", metrics.DefaultBuckets, "route", "method")
+	httpInFlight = metrics.NewGauge("listening_http_requests_in_flight", "HTTP requests currently being served.")
+)
+
+// observeRequest records a served request. The route is the ServeMux
+// pattern that matched so the label set stays bounded, requests that matched
+// nothing are recorded as "unmatched".
+func observeRequest(r *http.Request, status int, duration time.Duration) {
+	route := r.Pattern
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequests.Inc(route, r.Method, strconv.Itoa(status))
+	httpDuration.Observe(duration.Seconds(), route, r.Method)
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/apikey"
+	"github.com/shantanuraj/listening/pkg/config"
+)
+
+// Buckets that have been idle this long are full again and can be dropped.
+const bucketIdleTimeout = 10 * time.Minute
+
+// RateLimiter is a token-bucket limiter keyed by API key name, or by client
+// IP for anonymous requests.
+type RateLimiter struct {
+	mu        sync.Mutex
+	limit     config.RateLimit
+	trusted   []netip.Prefix
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	seenAt time.Time
+}
+
+func NewRateLimiter(limit config.RateLimit, trusted []netip.Prefix) *RateLimiter {
+	return &RateLimiter{
+		limit:     limit,
+		trusted:   trusted,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// SetLimit changes the limit applied to every bucket, keeping their
+// current levels.
+func (l *RateLimiter) SetLimit(limit config.RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+}
+
+// SetTrustedProxies changes which proxies' X-Forwarded-For is honoured.
+func (l *RateLimiter) SetTrustedProxies(trusted []netip.Prefix) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.trusted = trusted
+}
+
+// Allow takes a token from the bucket for key, returning how long to wait
+// before retrying when the bucket is empty.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	return l.allow(key, true)
+}
+
+// Peek is like Allow but leaves the token in the bucket.
+func (l *RateLimiter) Peek(key string) (bool, time.Duration) {
+	return l.allow(key, false)
+}
+
+func (l *RateLimiter) allow(key string, take bool) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	perSecond := l.limit.PerMinute / 60
+	burst := float64(l.limit.Burst)
+
+	if now.Sub(l.lastSweep) > bucketIdleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.seenAt) > bucketIdleTimeout {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, seenAt: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(burst, b.tokens+now.Sub(b.seenAt).Seconds()*perSecond)
+	b.seenAt = now
+
+	if b.tokens >= 1 {
+		if take {
+			b.tokens--
+		}
+		return true, 0
+	}
+	if perSecond <= 0 {
+		return false, time.Minute
+	}
+	return false, time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+}
+
+func (l *RateLimiter) key(r *http.Request) string {
+	if k, ok := apikey.FromContext(r.Context()); ok {
+		return "key:" + k.Name
+	}
+	return "ip:" + l.ClientIP(r)
+}
+
+// ClientIP returns the IP address requests without an API key are limited
+// by, honouring the trusted proxies of l.
+func (l *RateLimiter) ClientIP(r *http.Request) string {
+	l.mu.Lock()
+	trusted := l.trusted
+	l.mu.Unlock()
+	return ClientIP(r, trusted)
+}
+
+// WithRateLimit rejects requests with 429 once their bucket in l is empty.
+// It must run after WithAPIKey for requests to be limited per key.
+func WithRateLimit(l *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, retryAfter := l.Allow(l.key(r))
+			if !ok {
+				tooManyRequests(w, retryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/shantanuraj/listening/pkg/requestid"
+)
+
+// WithRequestID tags every request with an ID, taken from the X-Request-ID
+// header when the client sent a valid one and generated otherwise. The ID is
+// stored in the request context and echoed in the response.
+func WithRequestID() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestid.Header)
+			if !requestid.Valid(id) {
+				id = requestid.New()
+			}
+
+			w.Header().Set(requestid.Header, id)
+			next.ServeHTTP(w, r.WithContext(requestid.WithID(r.Context(), id)))
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/shantanuraj/listening/pkg/requestid"
+	"github.com/shantanuraj/listening/pkg/trace"
+)
+
+// WithTracing records a server span for each request, continuing the trace
+// from an incoming traceparent header. It does nothing while tracing is
+// disabled.
+func WithTracing() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !trace.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, span := trace.Start(trace.Extract(r.Context(), r.Header), r.Method, trace.KindServer)
+			defer span.End()
+
+			rw := &responseWriter{
+				ResponseWriter: w,
+				status:         http.StatusOK,
+			}
+			r = r.WithContext(ctx)
+			next.ServeHTTP(rw, r)
+
+			route := r.Pattern
+			if route == "" {
+				route = "unmatched"
+			} else {
+				span.SetName(route)
+			}
+			span.SetAttributes(
+				trace.Attr{Key: "http.request.method", Value: r.Method},
+				trace.Attr{Key: "http.route", Value: route},
+				trace.Attr{Key: "url.path", Value: r.URL.Path},
+				trace.Attr{Key: "url.query", Value: r.URL.RawQuery},
+				trace.Attr{Key: "http.response.status_code", Value: rw.status},
+				trace.Attr{Key: "http.response.body.size", Value: rw.bytes},
+				trace.Attr{Key: "request.id", Value: requestid.FromContext(ctx)},
+			)
+			if rw.status >= 500 {
+				span.SetStatus(trace.StatusError, strconv.Itoa(rw.status))
+			}
+		})
+	}
+}
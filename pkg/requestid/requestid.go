@@ -0,0 +1,48 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Header carries the request ID on incoming requests, responses and calls
+// to Spotify.
+const Header = "X-Request-ID"
+
+// maxLength bounds the IDs accepted from clients.
+const maxLength = 128
+
+// New returns a random request ID.
+func New() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether id is safe to echo back and write to logs: non-empty,
+// at most 128 characters and only printable ASCII without spaces.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+type contextKey struct{}
+
+// WithID returns a copy of ctx carrying the request ID.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,41 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/shantanuraj/listening/pkg/log"
+)
+
+const albumEndpoint = "/albums/"
+
+// ErrNotFound is returned when Spotify has nothing under the requested ID.
+var ErrNotFound = errors.New("not found")
+
+func (c *Client) Album(ctx context.Context, id string) (*Album, error) {
+	resp, err := c.Get(ctx, albumEndpoint+url.PathEscape(id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Spotify answers 400 for IDs that are not valid base62
+	if resp.StatusCode == 404 || resp.StatusCode == 400 {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != 200 {
+		log.WithContext(ctx).Errorf("album: unexpected status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("album: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var album Album
+	if err := json.NewDecoder(resp.Body).Decode(&album); err != nil {
+		log.WithContext(ctx).Errorf("album: failed to decode response: %v", err)
+		return nil, err
+	}
+
+	return &album, nil
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -19,12 +20,6 @@ import (
 const (
 	spotifyAuthURL  = "https://accounts.spotify.com/authorize"
 	spotifyTokenURL = "https://accounts.spotify.com/api/token"
-	scope           = "user-read-currently-playing user-read-playback-state user-modify-playback-state user-read-recently-played"
-)
-
-var (
-	clientID     = os.Getenv("SL_SPOTIFY_CLIENT_ID")
-	clientSecret = os.Getenv("SL_SPOTIFY_CLIENT_SECRET")
 )
 
 func redirectURL(addr string) string {
@@ -37,34 +32,46 @@ func generateState() string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
-func authURL(addr string, state string) string {
+func (c *Client) authURL(redirectURI string, state string) string {
 	return fmt.Sprintf(
 		"%s?response_type=code&client_id=%s&redirect_uri=%s&state=%s&scope=%s",
 		spotifyAuthURL,
-		clientID,
-		redirectURL(addr),
+		c.config.ClientID,
+		redirectURI,
 		state,
-		scope,
+		url.QueryEscape(strings.Join(c.consentScopes(), " ")),
 	)
 }
 
 func (c *Client) IsAuthenticated() bool {
-	return c.token != nil && !c.token.HasExpired()
+	token := c.token.Load()
+	return token != nil && !token.HasExpired()
 }
 
 func (c *Client) IsTokenExpired() bool {
-	if c.token == nil {
-		return false
+	token := c.token.Load()
+	return token != nil && token.HasExpired()
+}
+
+var ErrNotAuthenticated = errors.New("not authenticated")
+
+// EnsureAuthenticated refreshes the token if it has expired, returning
+// ErrNotAuthenticated when there is no token at all.
+func (c *Client) EnsureAuthenticated(ctx context.Context) error {
+	if c.IsAuthenticated() {
+		return nil
+	}
+	if !c.IsTokenExpired() {
+		return ErrNotAuthenticated
 	}
-	return c.token.HasExpired()
+	return c.RefreshToken(ctx)
 }
 
-func (c *Client) RegisterAuthenticationHandlers(
-	addr string,
-	mux *http.ServeMux,
-) error {
-	if clientID == "" || clientSecret == "" {
-		return fmt.Errorf("missing client ID or client secret")
+// LoadToken restores the persisted token unless the client already holds a
+// valid one.
+func (c *Client) LoadToken() error {
+	if c.IsAuthenticated() {
+		return nil
 	}
 
 	credentialsPath, err := dirs.CredentialsPath()
@@ -72,34 +79,108 @@ func (c *Client) RegisterAuthenticationHandlers(
 		return fmt.Errorf("failed to get credentials path: %w", err)
 	}
 
-	if !c.IsAuthenticated() {
-		token, err := loadToken(credentialsPath)
-		if err != nil {
-			return fmt.Errorf("failed to load persisted token: %w", err)
-		}
-		if token != nil {
-			c.token = token
-			log.Infof("Authenticated as %s", token.AccessToken[:8])
-		}
+	token, err := loadToken(credentialsPath)
+	if err != nil {
+		return fmt.Errorf("failed to load persisted token: %w", err)
+	}
+	if token != nil {
+		c.token.Store(token)
+		log.Infof("Authenticated as %s", token.AccessToken[:8])
 	}
 
+	return nil
+}
+
+// LoginURL returns the Spotify authorization URL that redirects back to
+// addr, along with the state the callback must echo.
+func (c *Client) LoginURL(addr string) (string, string) {
 	state := generateState()
+	return c.authURL(redirectURL(addr), state), state
+}
 
-	mux.Handle(
-		"GET /",
-		http.RedirectHandler(authURL(addr, state), http.StatusTemporaryRedirect),
-	)
-	mux.Handle("GET /callback", spotifyCallbackHandler(c, state, addr, credentialsPath))
-	mux.Handle("POST /refresh", refreshHandler(c))
+// CompleteLogin exchanges the authorization code from the OAuth callback for
+// a token and persists it.
+func (c *Client) CompleteLogin(ctx context.Context, addr string, code string) error {
+	return c.completeLogin(ctx, redirectURL(addr), code)
+}
+
+func (c *Client) completeLogin(ctx context.Context, redirectURI string, code string) error {
+	token, err := c.exchangeCode(ctx, redirectURI, code)
+	if err != nil {
+		return err
+	}
+
+	c.token.Store(token)
+	c.setUser(nil)
+	log.Infof("Authenticated as %s", token.AccessToken[:8])
+
+	if err := c.SaveToken(); err != nil {
+		log.Errorf("failed to save token: %v", err)
+	}
+
+	return nil
+}
+
+func (c *Client) RegisterAuthenticationHandlers(
+	addr string,
+	mux *http.ServeMux,
+) error {
+	if c.config.ClientID == "" || c.config.ClientSecret == "" {
+		return fmt.Errorf("missing client ID or client secret")
+	}
+
+	if err := c.LoadToken(); err != nil {
+		return err
+	}
+
+	_, state := c.LoginURL(addr)
+	c.loginPath = "/login"
+	c.logDisabledFeatures()
+
+	mux.Handle("GET /{$}", statusPageHandler(c, "/login"))
+	// Built per request so the requested scopes follow the current token
+	mux.HandleFunc("GET /login", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, c.authURL(redirectURL(addr), state), http.StatusTemporaryRedirect)
+	})
+	mux.Handle("GET /callback", spotifyCallbackHandler(c, state, addr))
 
 	return nil
 }
 
+// RegisterDeviceLoginHandlers is like RegisterAuthenticationHandlers, but
+// instead of the open OAuth redirect at / and /callback it serves the device
+// login relay page, so only someone holding the printed code can log in.
+// The relay routes are wrapped in limit, and wrong codes are counted per
+// client as identified by clientIP.
+func (c *Client) RegisterDeviceLoginHandlers(
+	addr string,
+	mux *http.ServeMux,
+	limit func(http.Handler) http.Handler,
+	clientIP func(*http.Request) string,
+) (*DeviceLogin, error) {
+	if c.config.ClientID == "" || c.config.ClientSecret == "" {
+		return nil, fmt.Errorf("missing client ID or client secret")
+	}
+
+	if err := c.LoadToken(); err != nil {
+		return nil, err
+	}
+
+	d := c.NewDeviceLogin(addr)
+	c.loginPath = "/device"
+	c.logDisabledFeatures()
+	d.SetClientIP(clientIP)
+	d.Register(mux, limit)
+
+	mux.Handle("GET /{$}", statusPageHandler(c, "/device"))
+
+	return d, nil
+}
+
 func spotifyCallbackHandler(
 	c *Client,
 	state string,
 	addr string,
-	credentialsPath string,
 ) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		query := r.URL.Query()
@@ -116,21 +197,55 @@ func spotifyCallbackHandler(
 
 		ctx := r.Context()
 
-		token, err := c.ExchangeCodeForToken(ctx, addr, code)
-		if err != nil {
+		if err := c.CompleteLogin(ctx, addr, code); err != nil {
+			log.Errorf("failed to exchange code for token: %v", err)
 			http.Error(w, "failed to exchange code for token", http.StatusInternalServerError)
 			return
 		}
 
-		c.token = token
-		log.Infof("Authenticated as %s", token.AccessToken[:8])
+		http.Redirect(w, r, "/current", http.StatusTemporaryRedirect)
+	}
+}
 
-		if err := saveToken(token, credentialsPath); err != nil {
-			log.Errorf("failed to save token: %v", err)
-		}
+// Logout forgets the current token and deletes the persisted credentials.
+// Spotify has no endpoint to revoke tokens, access can be removed entirely
+// from the Spotify account's app settings.
+func (c *Client) Logout() error {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
 
-		http.Redirect(w, r, "/current", http.StatusTemporaryRedirect)
+	c.token.Store(nil)
+	c.setUser(nil)
+
+	credentialsPath, err := dirs.CredentialsPath()
+	if err != nil {
+		return fmt.Errorf("failed to get credentials path: %w", err)
+	}
+
+	if err := os.Remove(credentialsPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete credentials: %w", err)
+	}
+
+	log.Infof("Logged out")
+	return nil
+}
+
+// SaveToken persists the current token so it survives a restart.
+func (c *Client) SaveToken() error {
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	token := c.token.Load()
+	if token == nil {
+		return nil
+	}
+
+	credentialsPath, err := dirs.CredentialsPath()
+	if err != nil {
+		return fmt.Errorf("failed to get credentials path: %w", err)
 	}
+
+	return saveToken(token, credentialsPath)
 }
 
 func saveToken(token *TokenResponse, path string) error {
@@ -163,17 +278,35 @@ func loadToken(path string) (*TokenResponse, error) {
 }
 
 func (c *Client) RefreshToken(ctx context.Context) error {
-	if c.token == nil {
+	err := c.refreshToken(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.lastRefreshErr = err
+		tokenRefreshes.Inc("error")
+	} else {
+		c.lastRefreshAt = time.Now()
+		c.lastRefreshErr = nil
+		tokenRefreshes.Inc("success")
+	}
+
+	return err
+}
+
+func (c *Client) refreshToken(ctx context.Context) error {
+	current := c.token.Load()
+	if current == nil {
 		return fmt.Errorf("no token to refresh")
 	}
 
-	refreshToken := c.token.RefreshToken
+	refreshToken := current.RefreshToken
 
 	data := url.Values{}
 	data.Set("grant_type", "refresh_token")
 	data.Set("refresh_token", refreshToken)
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
+	data.Set("client_id", c.config.ClientID)
+	data.Set("client_secret", c.config.ClientSecret)
 
 	req, err := http.NewRequestWithContext(
 		ctx,
@@ -210,7 +343,13 @@ func (c *Client) RefreshToken(ctx context.Context) error {
 		token.RefreshToken = refreshToken
 	}
 
-	c.token = &token
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+
+	// A logout or login while the refresh was in flight wins over it
+	if !c.token.CompareAndSwap(current, &token) {
+		return ErrNotAuthenticated
+	}
 	log.Infof("Authenticated as %s", token.AccessToken[:8])
 
 	credentialsPath, err := dirs.CredentialsPath()
@@ -230,16 +369,24 @@ func (c *Client) ExchangeCodeForToken(
 	addr string,
 	code string,
 ) (*TokenResponse, error) {
-	if clientID == "" || clientSecret == "" {
+	return c.exchangeCode(ctx, redirectURL(addr), code)
+}
+
+func (c *Client) exchangeCode(
+	ctx context.Context,
+	redirectURI string,
+	code string,
+) (*TokenResponse, error) {
+	if c.config.ClientID == "" || c.config.ClientSecret == "" {
 		return nil, fmt.Errorf("missing client ID or client secret")
 	}
 
 	data := url.Values{}
 	data.Set("grant_type", "authorization_code")
 	data.Set("code", code)
-	data.Set("redirect_uri", redirectURL(addr))
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("client_id", c.config.ClientID)
+	data.Set("client_secret", c.config.ClientSecret)
 
 	req, err := http.NewRequestWithContext(
 		ctx,
@@ -272,18 +419,18 @@ func (c *Client) ExchangeCodeForToken(
 	return &token, nil
 }
 
-func refreshHandler(c *Client) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
+// RefreshHandler refreshes the token on demand. It calls Spotify's token
+// endpoint, so callers must guard it with an API key and a rate limit.
+func (c *Client) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
-		if err := c.RefreshToken(ctx); err != nil {
-			log.Errorf("failed to refresh token: %v", err)
-			http.Error(w, "failed to refresh token", http.StatusInternalServerError)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
+	if err := c.RefreshToken(ctx); err != nil {
+		log.WithContext(ctx).Errorf("failed to refresh token: %v", err)
+		http.Error(w, "failed to refresh token", http.StatusInternalServerError)
+		return
 	}
+
+	w.WriteHeader(http.StatusOK)
 }
 
 type TokenResponse struct {
@@ -296,6 +443,16 @@ type TokenResponse struct {
 	CreatedAt time.Time `json:"created_at"` // Time when the token was created, not part of the JSON response
 }
 
+// ExpiresAt is when the access token stops being accepted.
+func (t TokenResponse) ExpiresAt() time.Time {
+	return t.CreatedAt.Add(time.Second * time.Duration(t.ExpiresIn))
+}
+
+// Scopes returns the scopes granted to the token.
+func (t TokenResponse) Scopes() []string {
+	return strings.Fields(t.Scope)
+}
+
 func (t TokenResponse) HasExpired() bool {
 	now := time.Now()
 	createdAt := t.CreatedAt
@@ -4,20 +4,47 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/shantanuraj/listening/pkg/config"
+	"github.com/shantanuraj/listening/pkg/log"
+	"github.com/shantanuraj/listening/pkg/requestid"
+	"github.com/shantanuraj/listening/pkg/trace"
 )
 
 type Client struct {
-	token      *TokenResponse
+	config config.Spotify
+	// token is replaced by logins, refreshes and logout while requests are
+	// reading it, so load it once and use the copy.
+	token      atomic.Pointer[TokenResponse]
 	httpClient *http.Client
+	// saveMu orders token changes with writes to the credentials file, so a
+	// login or refresh finishing after a logout cannot write the token back.
+	saveMu sync.Mutex
+
+	// loginPath is where the registered handlers start a login.
+	loginPath string
+
+	mu             sync.Mutex
+	user           *User
+	lastRefreshAt  time.Time
+	lastRefreshErr error
+
+	lastUpstreamOKAt time.Time
+	lastUpstreamErr  error
 }
 
 const host = "https://api.spotify.com/v1"
 
-var DefaultClient = &Client{
-	httpClient: &http.Client{
-		Timeout: time.Second * 10,
-	},
+func NewClient(cfg config.Spotify) *Client {
+	return &Client{
+		config: cfg,
+		httpClient: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
 }
 
 func (c *Client) Get(ctx context.Context, path string) (*http.Response, error) {
@@ -34,19 +61,52 @@ func (c *Client) do(
 	path string,
 	body io.Reader,
 ) (*http.Response, error) {
+	token := c.token.Load()
+	if token == nil {
+		return nil, ErrNotAuthenticated
+	}
+
 	url := host + path
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
 
+	ctx, span := trace.Start(ctx, "spotify "+method+" "+endpointTemplate(req.URL.Path), trace.KindClient)
+	defer span.End()
+
 	req.Header = http.Header{
-		"Authorization": []string{"Bearer " + c.token.AccessToken},
+		"Authorization": []string{"Bearer " + token.AccessToken},
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
 	}
+	trace.Inject(ctx, req.Header)
 
-	return c.httpClient.Do(req)
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	observeUpstream(req, resp, time.Since(start))
+	c.recordUpstream(resp, err)
+	span.SetAttributes(
+		trace.Attr{Key: "http.request.method", Value: method},
+		trace.Attr{Key: "server.address", Value: req.URL.Host},
+		trace.Attr{Key: "url.full", Value: req.URL.String()},
+	)
+	span.RecordError(err)
+	if resp != nil {
+		span.SetAttributes(trace.Attr{Key: "http.response.status_code", Value: resp.StatusCode})
+		if resp.StatusCode >= 500 {
+			span.SetStatus(trace.StatusError, resp.Status)
+		}
+	}
+	if err != nil {
+		log.WithContext(ctx).Errorf("spotify: %s %s failed after %v: %v", method, path, time.Since(start), err)
+	} else {
+		log.WithContext(ctx).Debugf("spotify: %s %s %d in %v", method, path, resp.StatusCode, time.Since(start))
+	}
+	return resp, err
 }
 
 func (c *Client) SetToken(token *TokenResponse) {
-	c.token = token
+	c.token.Store(token)
 }
@@ -10,7 +10,7 @@ import (
 
 const currentlyListeningEndpoint = "/me/player/currently-playing"
 
-func (c Client) CurrentlyListening(ctx context.Context) (*CurrentlyPlayingResponse, error) {
+func (c *Client) CurrentlyListening(ctx context.Context) (*CurrentlyPlayingResponse, error) {
 	resp, err := c.Get(ctx, currentlyListeningEndpoint)
 	if err != nil {
 		return nil, err
@@ -21,13 +21,13 @@ func (c Client) CurrentlyListening(ctx context.Context) (*CurrentlyPlayingRespon
 		return nil, nil
 	}
 	if resp.StatusCode != 200 {
-		log.Errorf("current: unexpected status code: %d", resp.StatusCode)
+		log.WithContext(ctx).Errorf("current: unexpected status code: %d", resp.StatusCode)
 		return nil, fmt.Errorf("current: unexpected status code: %d", resp.StatusCode)
 	}
 
 	var currentlyPlaying CurrentlyPlayingResponse
 	if err := json.NewDecoder(resp.Body).Decode(&currentlyPlaying); err != nil {
-		log.Errorf("current: failed to decode response: %v", err)
+		log.WithContext(ctx).Errorf("current: failed to decode response: %v", err)
 		return nil, err
 	}
 
@@ -0,0 +1,244 @@
+package spotify
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/log"
+)
+
+const (
+	deviceCodeTTL      = 10 * time.Minute
+	deviceCodeAttempts = 5
+	// Vowel-free so codes cannot spell words, per RFC 8628
+	deviceCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+)
+
+var devicePage = template.Must(template.New("device").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>listening: log in</title></head>
+<body>
+<h1>Connect Spotify</h1>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .Form}}
+<form method="post" action="/device">
+<label>Code <input name="code" autocomplete="off" autofocus placeholder="XXXX-XXXX"></label>
+<button type="submit">Continue</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+type devicePageData struct {
+	Message string
+	Form    bool
+}
+
+// DeviceLogin lets an operator authorize a headless host from any browser.
+// The host prints a short URL and a one-time code, the operator enters the
+// code on the relay page at /device, and only a browser that presented the
+// code can complete the OAuth flow.
+type DeviceLogin struct {
+	client *Client
+	addr   string
+	done   chan error
+
+	// clientIP identifies the client wrong codes are counted against.
+	clientIP func(*http.Request) string
+
+	mu        sync.Mutex
+	code      string
+	state     string
+	expiresAt time.Time
+	// Wrong codes entered per client since the current code was issued
+	attempts map[string]int
+}
+
+func (c *Client) NewDeviceLogin(addr string) *DeviceLogin {
+	return &DeviceLogin{
+		client:   c,
+		addr:     addr,
+		done:     make(chan error, 1),
+		clientIP: remoteIP,
+		attempts: make(map[string]int),
+	}
+}
+
+// SetClientIP replaces how the client of a request is identified, by default
+// its remote address, for hosts behind a reverse proxy.
+func (d *DeviceLogin) SetClientIP(clientIP func(*http.Request) string) {
+	d.clientIP = clientIP
+}
+
+// URL is the relay page the operator visits to enter the code.
+func (d *DeviceLogin) URL() string {
+	return d.addr + "/device"
+}
+
+func (d *DeviceLogin) redirectURI() string {
+	return d.addr + "/device/callback"
+}
+
+// Start issues a new code, invalidating any previous one, and logs where to
+// enter it.
+func (d *DeviceLogin) Start() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.startLocked()
+}
+
+func (d *DeviceLogin) startLocked() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = deviceCodeAlphabet[int(b[i])%len(deviceCodeAlphabet)]
+	}
+
+	d.code = string(b[:4]) + "-" + string(b[4:])
+	d.state = generateState()
+	d.expiresAt = time.Now().Add(deviceCodeTTL)
+	clear(d.attempts)
+
+	log.Infof("To log in visit %s and enter the code %s", d.URL(), d.code)
+	return d.code
+}
+
+// Wait blocks until a login completes or ctx is done.
+func (d *DeviceLogin) Wait(ctx context.Context) error {
+	select {
+	case err := <-d.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Register adds the relay page and its OAuth callback to mux, wrapped in
+// limit unless it is nil.
+func (d *DeviceLogin) Register(mux *http.ServeMux, limit func(http.Handler) http.Handler) {
+	if limit == nil {
+		limit = func(h http.Handler) http.Handler { return h }
+	}
+	mux.Handle("GET /device", limit(http.HandlerFunc(d.pageHandler)))
+	mux.Handle("POST /device", limit(http.HandlerFunc(d.codeHandler)))
+	mux.Handle("GET /device/callback", limit(http.HandlerFunc(d.callbackHandler)))
+}
+
+func (d *DeviceLogin) pageHandler(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	if d.code == "" || time.Now().After(d.expiresAt) {
+		d.startLocked()
+	}
+	d.mu.Unlock()
+
+	renderDevicePage(w, http.StatusOK, devicePageData{
+		Message: "Enter the code printed by the server.",
+		Form:    true,
+	})
+}
+
+func (d *DeviceLogin) codeHandler(w http.ResponseWriter, r *http.Request) {
+	entered := normalizeDeviceCode(r.FormValue("code"))
+	client := d.clientIP(r)
+
+	// Wrong codes only lock out the client entering them, so nobody else can
+	// invalidate the code the operator is about to type.
+	d.mu.Lock()
+	expired := d.code == "" || time.Now().After(d.expiresAt)
+	locked := d.attempts[client] >= deviceCodeAttempts
+	valid := !expired && !locked && subtle.ConstantTimeCompare([]byte(entered), []byte(normalizeDeviceCode(d.code))) == 1
+	state := d.state
+	if !valid && !expired && !locked {
+		d.attempts[client]++
+		if d.attempts[client] == deviceCodeAttempts {
+			log.Warnf("device login: too many invalid codes from %s, ignoring it until a new code is issued", client)
+		}
+	}
+	d.mu.Unlock()
+
+	if locked {
+		renderDevicePage(w, http.StatusTooManyRequests, devicePageData{
+			Message: "Too many invalid codes, wait for the server to issue a new one.",
+		})
+		return
+	}
+	if !valid {
+		renderDevicePage(w, http.StatusForbidden, devicePageData{
+			Message: "That code is invalid or has expired, check the server output for the current code.",
+			Form:    true,
+		})
+		return
+	}
+
+	http.Redirect(w, r, d.client.authURL(d.redirectURI(), state), http.StatusSeeOther)
+}
+
+func (d *DeviceLogin) callbackHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	d.mu.Lock()
+	state := d.state
+	expired := time.Now().After(d.expiresAt)
+	d.mu.Unlock()
+
+	if state == "" || expired || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		renderDevicePage(w, http.StatusBadRequest, devicePageData{Message: "This login link has expired, start again."})
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		renderDevicePage(w, http.StatusBadRequest, devicePageData{
+			Message: fmt.Sprintf("Spotify did not authorize the login: %s", query.Get("error")),
+		})
+		return
+	}
+
+	if err := d.client.completeLogin(r.Context(), d.redirectURI(), code); err != nil {
+		log.Errorf("device login: failed to exchange code for token: %v", err)
+		renderDevicePage(w, http.StatusInternalServerError, devicePageData{Message: "Failed to complete the login."})
+		return
+	}
+
+	// Codes are single use
+	d.mu.Lock()
+	d.code, d.state = "", ""
+	d.mu.Unlock()
+
+	select {
+	case d.done <- nil:
+	default:
+	}
+
+	renderDevicePage(w, http.StatusOK, devicePageData{Message: "Logged in, you can close this window."})
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func normalizeDeviceCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func renderDevicePage(w http.ResponseWriter, status int, data devicePageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := devicePage.Execute(w, data); err != nil {
+		log.Errorf("device login: failed to render page: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package spotify
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CheckToken reports whether the client holds a token it can use or refresh.
+func (c *Client) CheckToken() error {
+	token := c.token.Load()
+	if token == nil {
+		return ErrNotAuthenticated
+	}
+
+	c.mu.Lock()
+	lastRefreshErr := c.lastRefreshErr
+	c.mu.Unlock()
+
+	if !token.HasExpired() {
+		return nil
+	}
+	if token.RefreshToken == "" {
+		return fmt.Errorf("token expired at %s and has no refresh token", token.ExpiresAt().Format(time.RFC3339))
+	}
+	if lastRefreshErr != nil {
+		return fmt.Errorf("token expired and the last refresh failed: %w", lastRefreshErr)
+	}
+	return nil
+}
+
+// CheckUpstream reports an error when the last Spotify API call failed and
+// none has succeeded within window. A client that has not called Spotify yet
+// is considered healthy.
+func (c *Client) CheckUpstream(window time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lastUpstreamErr == nil || time.Since(c.lastUpstreamOKAt) < window {
+		return nil
+	}
+	if c.lastUpstreamOKAt.IsZero() {
+		return fmt.Errorf("no successful spotify call yet, last error: %w", c.lastUpstreamErr)
+	}
+	return fmt.Errorf("no successful spotify call since %s, last error: %w", c.lastUpstreamOKAt.Format(time.RFC3339), c.lastUpstreamErr)
+}
+
+// recordUpstream remembers the outcome of a Spotify API call. Only transport
+// errors, rate limiting and server errors count as failures, other statuses
+// are answers about the request itself.
+func (c *Client) recordUpstream(resp *http.Response, err error) {
+	if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) {
+		err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastUpstreamErr = err
+	if err == nil {
+		c.lastUpstreamOKAt = time.Now()
+	}
+}
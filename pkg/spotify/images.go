@@ -0,0 +1,26 @@
+package spotify
+
+// ClosestImage returns the image whose width is closest to size, preferring
+// the larger of two equally close images so it can be scaled down.
+func ClosestImage(images []Image, size int64) (Image, bool) {
+	var best Image
+	found := false
+	for _, image := range images {
+		if !found {
+			best, found = image, true
+			continue
+		}
+		d, bestD := abs(image.Width-size), abs(best.Width-size)
+		if d < bestD || (d == bestD && image.Width > best.Width) {
+			best = image
+		}
+	}
+	return best, found
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
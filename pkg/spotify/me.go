@@ -0,0 +1,55 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/shantanuraj/listening/pkg/log"
+)
+
+const meEndpoint = "/me"
+
+// CurrentUser returns the profile of the logged in account. The profile is
+// fetched once per login and then remembered.
+func (c *Client) CurrentUser(ctx context.Context) (*User, error) {
+	c.mu.Lock()
+	user := c.user
+	c.mu.Unlock()
+	if user != nil {
+		return user, nil
+	}
+
+	resp, err := c.Get(ctx, meEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		log.WithContext(ctx).Errorf("me: unexpected status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("me: unexpected status code: %d", resp.StatusCode)
+	}
+
+	user = &User{}
+	if err := json.NewDecoder(resp.Body).Decode(user); err != nil {
+		log.WithContext(ctx).Errorf("me: failed to decode response: %v", err)
+		return nil, err
+	}
+
+	c.setUser(user)
+	return user, nil
+}
+
+func (c *Client) setUser(user *User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.user = user
+}
+
+type User struct {
+	DisplayName  string       `json:"display_name"`
+	ExternalUrls ExternalUrls `json:"external_urls"`
+	ID           string       `json:"id"`
+	URI          string       `json:"uri"`
+}
@@ -0,0 +1,54 @@
+package spotify
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/metrics"
+)
+
+var (
+	upstreamRequests = metrics.NewCounter("listening_spotify_requests_total", "Spotify API calls by endpoint and status code.", "method", "endpoint", "status")
+	upstreamDuration = metrics.NewHistogram("listening_spotify_request_duration_seconds", "Spotify API call latency by endpoint.", metrics.DefaultBuckets, "method", "endpoint")
+	tokenRefreshes   = metrics.NewCounter("listening_spotify_token_refreshes_total", "Token refreshes by result.", "result")
+)
+
+// observeUpstream records a Spotify API call. The endpoint is the request
+// path without its query, failed requests are recorded with status "error".
+func observeUpstream(req *http.Request, resp *http.Response, duration time.Duration) {
+	status := "error"
+	if resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	endpoint := endpointTemplate(req.URL.Path)
+	upstreamRequests.Inc(req.Method, endpoint, status)
+	upstreamDuration.Observe(duration.Seconds(), req.Method, endpoint)
+}
+
+// idCollections are the path segments of the Spotify API that are followed
+// by an ID.
+var idCollections = map[string]bool{
+	"albums":     true,
+	"artists":    true,
+	"audiobooks": true,
+	"chapters":   true,
+	"episodes":   true,
+	"playlists":  true,
+	"shows":      true,
+	"tracks":     true,
+	"users":      true,
+}
+
+// endpointTemplate replaces the IDs in path with {id}, so every album or
+// track shares one endpoint label instead of adding a new one per ID.
+func endpointTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		if idCollections[segments[i-1]] && segments[i] != "" {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
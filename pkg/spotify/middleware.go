@@ -1,6 +1,7 @@
 package spotify
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/shantanuraj/listening/pkg/log"
@@ -10,17 +11,14 @@ func (c *Client) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		if !c.IsAuthenticated() {
-			if c.IsTokenExpired() {
-				if err := c.RefreshToken(ctx); err != nil {
-					log.Errorf("auth: failed to refresh token: %v", err)
-					http.Error(w, "failed to refresh token", http.StatusInternalServerError)
-					return
-				}
-			} else {
+		if err := c.EnsureAuthenticated(ctx); err != nil {
+			if errors.Is(err, ErrNotAuthenticated) {
 				http.Error(w, "not authenticated", http.StatusUnauthorized)
 				return
 			}
+			log.WithContext(r.Context()).Errorf("auth: failed to refresh token: %v", err)
+			http.Error(w, "failed to refresh token", http.StatusInternalServerError)
+			return
 		}
 
 		next(w, r)
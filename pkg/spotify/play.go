@@ -23,22 +23,22 @@ type Offset struct {
 	URI      string `json:"uri,omitempty"`
 }
 
-func (c Client) Play(ctx context.Context, req PlayRequest) error {
+func (c *Client) Play(ctx context.Context, req PlayRequest) error {
 	data, err := json.Marshal(req)
 	if err != nil {
-		log.Errorf("play: failed to marshal request: %v", err)
+		log.WithContext(ctx).Errorf("play: failed to marshal request: %v", err)
 		return fmt.Errorf("play: failed to marshal request: %w", err)
 	}
 	resp, err := c.Put(ctx, playEndpoint, bytes.NewReader(data))
 	if err != nil {
-		log.Errorf("play: failed to make request: %v", err)
+		log.WithContext(ctx).Errorf("play: failed to make request: %v", err)
 		return err
 	}
 
 	if resp.StatusCode != 204 {
-		log.Errorf("play: unexpected status code: %d", resp.StatusCode)
+		log.WithContext(ctx).Errorf("play: unexpected status code: %d", resp.StatusCode)
 		reqStr, _ := json.MarshalIndent(req, "", "  ")
-		log.Errorf("play: request: %s", reqStr)
+		log.WithContext(ctx).Errorf("play: request: %s", reqStr)
 		return fmt.Errorf("play: unexpected status code: %d", resp.StatusCode)
 	}
 
@@ -10,7 +10,7 @@ import (
 
 const queueEndpoint = "/me/player/queue"
 
-func (c Client) Queue(ctx context.Context) (*QueueResponse, error) {
+func (c *Client) Queue(ctx context.Context) (*QueueResponse, error) {
 	resp, err := c.Get(ctx, queueEndpoint)
 	if err != nil {
 		return nil, err
@@ -21,13 +21,13 @@ func (c Client) Queue(ctx context.Context) (*QueueResponse, error) {
 		return nil, nil
 	}
 	if resp.StatusCode != 200 {
-		log.Errorf("queue: unexpected status code: %d", resp.StatusCode)
+		log.WithContext(ctx).Errorf("queue: unexpected status code: %d", resp.StatusCode)
 		return nil, fmt.Errorf("queue: unexpected status code: %d", resp.StatusCode)
 	}
 
 	var queue QueueResponse
 	if err := json.NewDecoder(resp.Body).Decode(&queue); err != nil {
-		log.Errorf("queue: failed to decode response: %v", err)
+		log.WithContext(ctx).Errorf("queue: failed to decode response: %v", err)
 		return nil, err
 	}
 
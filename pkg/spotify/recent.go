@@ -11,7 +11,7 @@ import (
 
 const recentEndpoint = "/me/player/recently-played"
 
-func (c Client) RecentlyPlayed(ctx context.Context, limit int) (*RecentlyPlayedResponse, error) {
+func (c *Client) RecentlyPlayed(ctx context.Context, limit int) (*RecentlyPlayedResponse, error) {
 	resp, err := c.Get(ctx, fmt.Sprintf("%s?limit=%d", recentEndpoint, limit))
 	if err != nil {
 		return nil, err
@@ -19,13 +19,13 @@ func (c Client) RecentlyPlayed(ctx context.Context, limit int) (*RecentlyPlayedR
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		log.Errorf("recently played: unexpected status code: %d", resp.StatusCode)
+		log.WithContext(ctx).Errorf("recently played: unexpected status code: %d", resp.StatusCode)
 		return nil, fmt.Errorf("recently played: unexpected status code: %d", resp.StatusCode)
 	}
 
 	var recent RecentlyPlayedResponse
 	if err := json.NewDecoder(resp.Body).Decode(&recent); err != nil {
-		log.Errorf("recently played: failed to decode response: %v", err)
+		log.WithContext(ctx).Errorf("recently played: failed to decode response: %v", err)
 		return nil, err
 	}
 
@@ -0,0 +1,194 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/log"
+)
+
+// Feature is a group of endpoints that share the Spotify scopes they need.
+type Feature string
+
+const (
+	FeatureCurrent Feature = "current"
+	FeatureQueue   Feature = "queue"
+	FeatureRecent  Feature = "recent"
+	FeatureTop     Feature = "top"
+	FeaturePlay    Feature = "play"
+)
+
+// featureScopes lists the scopes each feature needs. Adding a scope here is
+// enough for existing tokens to be flagged for re-consent.
+var featureScopes = map[Feature][]string{
+	FeatureCurrent: {"user-read-currently-playing"},
+	FeatureQueue:   {"user-read-currently-playing", "user-read-playback-state"},
+	FeatureRecent:  {"user-read-recently-played"},
+	FeatureTop:     {"user-top-read"},
+	FeaturePlay:    {"user-modify-playback-state"},
+}
+
+// RequiredScopes are the scopes every feature of the server needs.
+func RequiredScopes() []string {
+	var scopes []string
+	for _, s := range featureScopes {
+		scopes = append(scopes, s...)
+	}
+	slices.Sort(scopes)
+	return slices.Compact(scopes)
+}
+
+// consentScopes are the scopes to request when logging in: everything the
+// features need plus anything the current token was already granted.
+func (c *Client) consentScopes() []string {
+	scopes := RequiredScopes()
+	if token := c.token.Load(); token != nil {
+		scopes = append(scopes, token.Scopes()...)
+	}
+	slices.Sort(scopes)
+	return slices.Compact(scopes)
+}
+
+// missingScopes returns which of scopes the current token was not granted.
+// Tokens that do not report their scopes are assumed to have them all.
+func (c *Client) missingScopes(scopes []string) []string {
+	token := c.token.Load()
+	if token == nil || token.Scope == "" {
+		return nil
+	}
+
+	granted := token.Scopes()
+	var missing []string
+	for _, s := range scopes {
+		if !slices.Contains(granted, s) {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// MissingScopes returns the required scopes the current token was not
+// granted, for example because it predates a feature that needs a new scope.
+func (c *Client) MissingScopes() []string {
+	return c.missingScopes(RequiredScopes())
+}
+
+// FeatureMissingScopes returns the scopes feature needs that the current
+// token was not granted. The feature is disabled until they are granted.
+func (c *Client) FeatureMissingScopes(feature Feature) []string {
+	return c.missingScopes(featureScopes[feature])
+}
+
+// DisabledFeatures returns the features the current token lacks scopes for.
+func (c *Client) DisabledFeatures() []Feature {
+	var disabled []Feature
+	for _, f := range slices.Sorted(maps.Keys(featureScopes)) {
+		if len(c.FeatureMissingScopes(f)) > 0 {
+			disabled = append(disabled, f)
+		}
+	}
+	return disabled
+}
+
+func (c *Client) logDisabledFeatures() {
+	for _, f := range c.DisabledFeatures() {
+		log.Warnf(
+			"feature %s is disabled, the stored token is missing %s, visit %s to grant it",
+			f,
+			strings.Join(c.FeatureMissingScopes(f), ", "),
+			c.loginPath,
+		)
+	}
+}
+
+// FeatureMiddleware is AuthMiddleware for routes belonging to feature,
+// rejecting requests while the token lacks the scopes the feature needs
+// instead of letting them fail upstream.
+func (c *Client) FeatureMiddleware(feature Feature, next http.HandlerFunc) http.HandlerFunc {
+	return c.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if missing := c.FeatureMissingScopes(feature); len(missing) > 0 {
+			if c.loginPath != "" {
+				w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"reconsent\"", c.loginPath))
+			}
+			http.Error(
+				w,
+				fmt.Sprintf("%s is disabled until Spotify access is granted for %s, log in again at %s", feature, strings.Join(missing, ", "), c.loginPath),
+				http.StatusForbidden,
+			)
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+type AuthStatus struct {
+	Authenticated    bool       `json:"authenticated"`
+	TokenPresent     bool       `json:"token_present"`
+	Expired          bool       `json:"expired"`
+	User             *User      `json:"user,omitempty"`
+	UserError        string     `json:"user_error,omitempty"`
+	Scopes           []string   `json:"scopes"`
+	RequiredScopes   []string   `json:"required_scopes"`
+	MissingScopes    []string   `json:"missing_scopes"`
+	DisabledFeatures []Feature  `json:"disabled_features"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	LastRefreshAt    *time.Time `json:"last_refresh_at,omitempty"`
+	LastRefreshError string     `json:"last_refresh_error,omitempty"`
+	// ReconsentURL is where to log in again to grant missing scopes.
+	ReconsentURL string `json:"reconsent_url,omitempty"`
+}
+
+// Status describes the current token, looking up the account it belongs to.
+func (c *Client) Status(ctx context.Context) AuthStatus {
+	status := AuthStatus{
+		Authenticated:    c.IsAuthenticated(),
+		Expired:          c.IsTokenExpired(),
+		Scopes:           []string{},
+		RequiredScopes:   RequiredScopes(),
+		MissingScopes:    []string{},
+		DisabledFeatures: []Feature{},
+	}
+
+	c.mu.Lock()
+	if !c.lastRefreshAt.IsZero() {
+		lastRefreshAt := c.lastRefreshAt
+		status.LastRefreshAt = &lastRefreshAt
+	}
+	if c.lastRefreshErr != nil {
+		status.LastRefreshError = c.lastRefreshErr.Error()
+	}
+	c.mu.Unlock()
+
+	token := c.token.Load()
+	if token == nil {
+		status.ReconsentURL = c.loginPath
+		return status
+	}
+
+	status.TokenPresent = true
+	expiresAt := token.ExpiresAt()
+	status.ExpiresAt = &expiresAt
+	status.Scopes = append(status.Scopes, token.Scopes()...)
+	status.MissingScopes = append(status.MissingScopes, c.MissingScopes()...)
+	status.DisabledFeatures = append(status.DisabledFeatures, c.DisabledFeatures()...)
+	if len(status.MissingScopes) > 0 {
+		status.ReconsentURL = c.loginPath
+	}
+
+	if status.Authenticated {
+		user, err := c.CurrentUser(ctx)
+		if err != nil {
+			status.UserError = err.Error()
+		} else {
+			status.User = user
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,50 @@
+package spotify
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/shantanuraj/listening/pkg/log"
+)
+
+var statusPage = template.Must(template.New("status").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>listening</title></head>
+<body>
+<h1>listening</h1>
+{{if .Connected}}
+<p>Connected to Spotify. The currently playing track is at <a href="/current">/current</a>.</p>
+{{if .DisabledFeatures}}
+<p>Some features are disabled because the connection is missing permissions they need:
+{{range $i, $f := .DisabledFeatures}}{{if $i}}, {{end}}<code>{{$f}}</code>{{end}}.</p>
+<p><a href="{{.LoginPath}}">Grant the missing permissions</a></p>
+{{end}}
+{{else}}
+<p>Not connected to Spotify.</p>
+<p><a href="{{.LoginPath}}">Connect Spotify</a></p>
+{{end}}
+</body>
+</html>
+`))
+
+// statusPageHandler shows whether the server holds a Spotify token, linking
+// to loginPath to connect one when it does not.
+func statusPageHandler(c *Client, loginPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			Connected        bool
+			DisabledFeatures []Feature
+			LoginPath        string
+		}{
+			Connected:        c.token.Load() != nil,
+			DisabledFeatures: c.DisabledFeatures(),
+			LoginPath:        loginPath,
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := statusPage.Execute(w, data); err != nil {
+			log.Errorf("status: failed to render page: %v", err)
+		}
+	}
+}
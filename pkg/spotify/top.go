@@ -0,0 +1,113 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/shantanuraj/listening/pkg/log"
+)
+
+const (
+	topArtistsEndpoint = "/me/top/artists"
+	topTracksEndpoint  = "/me/top/tracks"
+)
+
+// TimeRange is the window over which Spotify computes a user's top items.
+type TimeRange string
+
+const (
+	ShortTerm  TimeRange = "short_term"  // Approximately the last 4 weeks
+	MediumTerm TimeRange = "medium_term" // Approximately the last 6 months
+	LongTerm   TimeRange = "long_term"   // Approximately the last year
+)
+
+// ParseTimeRange validates a time range, defaulting to MediumTerm when empty.
+func ParseTimeRange(s string) (TimeRange, error) {
+	switch TimeRange(s) {
+	case "":
+		return MediumTerm, nil
+	case ShortTerm, MediumTerm, LongTerm:
+		return TimeRange(s), nil
+	default:
+		return "", fmt.Errorf("invalid time range: %q", s)
+	}
+}
+
+func topQuery(timeRange TimeRange, limit int) string {
+	query := url.Values{}
+	query.Set("time_range", string(timeRange))
+	query.Set("limit", strconv.Itoa(limit))
+	return query.Encode()
+}
+
+func (c *Client) TopArtists(ctx context.Context, timeRange TimeRange, limit int) (*TopArtistsResponse, error) {
+	resp, err := c.Get(ctx, fmt.Sprintf("%s?%s", topArtistsEndpoint, topQuery(timeRange, limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		log.WithContext(ctx).Errorf("top artists: unexpected status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("top artists: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var top TopArtistsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&top); err != nil {
+		log.WithContext(ctx).Errorf("top artists: failed to decode response: %v", err)
+		return nil, err
+	}
+
+	return &top, nil
+}
+
+func (c *Client) TopTracks(ctx context.Context, timeRange TimeRange, limit int) (*TopTracksResponse, error) {
+	resp, err := c.Get(ctx, fmt.Sprintf("%s?%s", topTracksEndpoint, topQuery(timeRange, limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		log.WithContext(ctx).Errorf("top tracks: unexpected status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("top tracks: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var top TopTracksResponse
+	if err := json.NewDecoder(resp.Body).Decode(&top); err != nil {
+		log.WithContext(ctx).Errorf("top tracks: failed to decode response: %v", err)
+		return nil, err
+	}
+
+	return &top, nil
+}
+
+type TopArtistsResponse struct {
+	Items []TopArtist `json:"items"`
+	Total int64       `json:"total"`
+}
+
+type TopTracksResponse struct {
+	Items []Item `json:"items"`
+	Total int64  `json:"total"`
+}
+
+type TopArtist struct {
+	ExternalUrls ExternalUrls `json:"external_urls"`
+	Followers    Followers    `json:"followers"`
+	Genres       []string     `json:"genres"`
+	Href         string       `json:"href"`
+	ID           string       `json:"id"`
+	Images       []Image      `json:"images"`
+	Name         string       `json:"name"`
+	Popularity   int64        `json:"popularity"`
+	Type         string       `json:"type"`
+	URI          string       `json:"uri"`
+}
+
+type Followers struct {
+	Total int64 `json:"total"`
+}
@@ -0,0 +1,344 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shantanuraj/listening/pkg/log"
+)
+
+const (
+	batchSize     = 256
+	maxQueued     = 4096
+	flushInterval = 5 * time.Second
+)
+
+// Exporter sends batches of ended spans somewhere they can be inspected.
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Tracer batches ended spans and hands them to its exporter in the
+// background.
+type Tracer struct {
+	service  string
+	exporter Exporter
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func NewTracer(service string, exporter Exporter) *Tracer {
+	t := &Tracer{
+		service:  service,
+		exporter: exporter,
+		flush:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.queue) >= maxQueued {
+		t.dropped++
+		return
+	}
+	t.queue = append(t.queue, s)
+	if len(t.queue) >= batchSize {
+		select {
+		case t.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.flush:
+		case <-t.stop:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), flushInterval)
+		t.export(ctx)
+		cancel()
+	}
+}
+
+func (t *Tracer) export(ctx context.Context) {
+	t.mu.Lock()
+	spans, dropped := t.queue, t.dropped
+	t.queue, t.dropped = nil, 0
+	t.mu.Unlock()
+
+	if dropped > 0 {
+		log.Warnf("trace: dropped %d spans, the exporter is not keeping up", dropped)
+	}
+	for len(spans) > 0 {
+		n := min(len(spans), batchSize)
+		if err := t.exporter.Export(ctx, spans[:n]); err != nil {
+			log.Errorf("trace: failed to export %d spans: %v", n, err)
+		}
+		spans = spans[n:]
+	}
+}
+
+// Shutdown stops the background exporter, exports the spans still queued
+// and closes the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) {
+	close(t.stop)
+	<-t.done
+	t.export(ctx)
+	if c, ok := t.exporter.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Errorf("trace: failed to close exporter: %v", err)
+		}
+	}
+}
+
+// NewExporter returns an exporter appending OTLP/JSON to file, posting it to
+// an OTLP/HTTP collector at endpoint, or both.
+func NewExporter(service string, file string, endpoint string) (Exporter, error) {
+	var exporters multiExporter
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporters = append(exporters, &fileExporter{service: service, f: f})
+	}
+	if endpoint != "" {
+		if u, err := url.Parse(endpoint); err == nil && (u.Path == "" || u.Path == "/") {
+			endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+		}
+		exporters = append(exporters, &httpExporter{
+			service:  service,
+			endpoint: endpoint,
+			client:   &http.Client{Timeout: 10 * time.Second},
+		})
+	}
+	if len(exporters) == 0 {
+		return nil, errors.New("no trace file or endpoint configured")
+	}
+	return exporters, nil
+}
+
+type multiExporter []Exporter
+
+func (m multiExporter) Export(ctx context.Context, spans []*Span) error {
+	var errs []error
+	for _, e := range m {
+		errs = append(errs, e.Export(ctx, spans))
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiExporter) Close() error {
+	var errs []error
+	for _, e := range m {
+		if c, ok := e.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fileExporter appends one OTLP/JSON export request per line, the format of
+// the OpenTelemetry collector's file exporter.
+type fileExporter struct {
+	service string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+func (e *fileExporter) Export(_ context.Context, spans []*Span) error {
+	body, err := json.Marshal(encodeOTLP(e.service, spans))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.f.Write(append(body, '\n'))
+	return err
+}
+
+func (e *fileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.f.Close()
+}
+
+// httpExporter posts OTLP/JSON export requests to a collector.
+type httpExporter struct {
+	service  string
+	endpoint string
+	client   *http.Client
+}
+
+func (e *httpExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(encodeOTLP(e.service, spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector: unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP/JSON encoding of ExportTraceServiceRequest. IDs are hex encoded and
+// 64 bit integers are strings, as the OTLP JSON mapping requires.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              Kind           `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+const scopeName = "github.com/shantanuraj/listening/pkg/trace"
+
+func encodeOTLP(service string, spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		encoded = append(encoded, encodeSpan(s))
+	}
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{encodeAttr(Attr{"service.name", service})},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: scopeName},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+func encodeSpan(s *Span) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := otlpSpan{
+		TraceID:           s.sc.TraceID.String(),
+		SpanID:            s.sc.SpanID.String(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Status:            otlpStatus{Code: s.status, Message: s.statusMsg},
+	}
+	if s.parent.IsValid() {
+		span.ParentSpanID = s.parent.String()
+	}
+	for _, a := range s.attrs {
+		span.Attributes = append(span.Attributes, encodeAttr(a))
+	}
+	return span
+}
+
+func encodeAttr(a Attr) otlpKeyValue {
+	var v otlpAnyValue
+	switch value := a.Value.(type) {
+	case string:
+		v.StringValue = &value
+	case int:
+		i := strconv.Itoa(value)
+		v.IntValue = &i
+	case int64:
+		i := strconv.FormatInt(value, 10)
+		v.IntValue = &i
+	case float64:
+		v.DoubleValue = &value
+	case bool:
+		v.BoolValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpKeyValue{Key: a.Key, Value: v}
+}
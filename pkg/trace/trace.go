@@ -0,0 +1,245 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+func (id SpanID) IsValid() bool  { return id != SpanID{} }
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Kind is the OTLP span kind.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// StatusCode is the OTLP span status code.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// Span is a timed operation within a trace. A nil *Span is valid and does
+// nothing, which is what Start returns while tracing is disabled.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	kind   Kind
+	start  time.Time
+
+	mu        sync.Mutex
+	name      string
+	end       time.Time
+	attrs     []Attr
+	status    StatusCode
+	statusMsg string
+	ended     bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// SetAttributes adds key-value pairs to the span.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.statusMsg = code, msg
+}
+
+// RecordError marks the span as failed with err, if err is not nil.
+func (s *Span) RecordError(err error) {
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+	}
+}
+
+// End finishes the span and queues it for export if it is sampled.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended, s.end = true, time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetDefault installs the tracer used by Start, nil disables tracing.
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Enabled reports whether spans are being recorded.
+func Enabled() bool {
+	return defaultTracer.Load() != nil
+}
+
+// Start begins a span as a child of the span or remote span context in ctx.
+// It returns a nil span while tracing is disabled.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	t := defaultTracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent := spanContextFrom(ctx); parent.IsValid() {
+		s.sc.TraceID, s.parent, s.sc.Sampled = parent.TraceID, parent.SpanID, parent.Sampled
+	} else {
+		_, _ = rand.Read(s.sc.TraceID[:])
+		s.sc.Sampled = true
+	}
+	_, _ = rand.Read(s.sc.SpanID[:])
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// FromContext returns the current span in ctx, or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+func spanContextFrom(ctx context.Context) SpanContext {
+	if s := FromContext(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// Header is the W3C Trace Context header.
+const Header = "traceparent"
+
+// Extract returns ctx carrying the remote span context from the traceparent
+// header in h, so the next span started continues the caller's trace.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, ok := ParseTraceparent(h.Get(Header))
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Inject sets the traceparent header in h from the span in ctx.
+func Inject(ctx context.Context, h http.Header) {
+	if sc := spanContextFrom(ctx); sc.IsValid() {
+		h.Set(Header, FormatTraceparent(sc))
+	}
+}
+
+// ParseTraceparent parses a version 00 traceparent header, accepting later
+// versions as long as they start with the same fields.
+func ParseTraceparent(v string) (SpanContext, bool) {
+	var sc SpanContext
+	v = strings.TrimSpace(v)
+	if len(v) < 55 || (len(v) > 55 && v[55] != '-') {
+		return sc, false
+	}
+	if v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return sc, false
+	}
+	version, traceID, spanID, flags := v[0:2], v[3:35], v[36:52], v[53:55]
+	if version == "ff" || (version == "00" && len(v) != 55) {
+		return sc, false
+	}
+	for _, field := range []string{version, traceID, spanID, flags} {
+		if strings.ToLower(field) != field {
+			return sc, false
+		}
+	}
+
+	var flagBytes [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(traceID)); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(spanID)); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(flagBytes[:], []byte(flags)); err != nil {
+		return sc, false
+	}
+	sc.Sampled = flagBytes[0]&0x01 == 1
+	return sc, sc.IsValid()
+}
+
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
@@ -0,0 +1,47 @@
+package trace
+
+import "testing"
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "0af7651916cd43dd8448eb211c80319c"
+		spanID  = "b7ad6b7169203331"
+	)
+
+	tests := []struct {
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"00-" + traceID + "-" + spanID + "-01", true, true},
+		{"00-" + traceID + "-" + spanID + "-00", true, false},
+		{" 00-" + traceID + "-" + spanID + "-01 ", true, true},
+		{"01-" + traceID + "-" + spanID + "-01-extra", true, true},
+		{"00-" + traceID + "-" + spanID + "-01-extra", false, false},
+		{"01-" + traceID + "-" + spanID + "-01extra", false, false},
+		{"ff-" + traceID + "-" + spanID + "-01", false, false},
+		{"00-" + "0AF7651916CD43DD8448EB211C80319C" + "-" + spanID + "-01", false, false},
+		{"00-" + "00000000000000000000000000000000" + "-" + spanID + "-01", false, false},
+		{"00-" + traceID + "-" + "0000000000000000" + "-01", false, false},
+		{"00-" + traceID + "-" + spanID + "-0g", false, false},
+		{"00_" + traceID + "-" + spanID + "-01", false, false},
+		{"00-" + traceID + "-" + spanID, false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		sc, ok := ParseTraceparent(tt.header)
+		if ok != tt.ok {
+			t.Errorf("ParseTraceparent(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if sc.TraceID.String() != traceID || sc.SpanID.String() != spanID || sc.Sampled != tt.sampled {
+			t.Errorf("ParseTraceparent(%q) = %s %s %v", tt.header, sc.TraceID, sc.SpanID, sc.Sampled)
+		}
+		if got := FormatTraceparent(sc); tt.header == "00-"+traceID+"-"+spanID+"-01" && got != tt.header {
+			t.Errorf("FormatTraceparent() = %q, want %q", got, tt.header)
+		}
+	}
+}